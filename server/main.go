@@ -4,15 +4,22 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/cmurphy/hns-list/pkg/audit"
+	"github.com/cmurphy/hns-list/pkg/authz"
+	"github.com/cmurphy/hns-list/pkg/certs"
 	"github.com/cmurphy/hns-list/pkg/handlers"
+	"github.com/cmurphy/hns-list/pkg/metrics"
+	"github.com/cmurphy/hns-list/pkg/policy"
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"github.com/cmurphy/hns-list/pkg/redaction"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -61,6 +68,18 @@ func main() {
 			Value:  "7443",
 			EnvVar: "LISTEN_PORT",
 		},
+		cli.StringFlag{
+			Name:   "metrics-host",
+			Usage:  "address to serve metrics on, which is not authenticated and so only local by default",
+			Value:  "127.0.0.1",
+			EnvVar: "METRICS_ADDRESS",
+		},
+		cli.StringFlag{
+			Name:   "metrics-port",
+			Usage:  "port to serve metrics on, metrics are disabled if empty",
+			Value:  "9090",
+			EnvVar: "METRICS_PORT",
+		},
 		cli.StringFlag{
 			Name:   "certpath",
 			Usage:  "path to cert",
@@ -71,6 +90,85 @@ func main() {
 			Usage:  "path to key",
 			EnvVar: "KEYPATH",
 		},
+		cli.DurationFlag{
+			Name:   "authorization-allow-ttl",
+			Usage:  "how long to cache allowed authorization decisions",
+			Value:  10 * time.Second,
+			EnvVar: "AUTHORIZATION_ALLOW_TTL",
+		},
+		cli.DurationFlag{
+			Name:   "authorization-deny-ttl",
+			Usage:  "how long to cache denied authorization decisions",
+			Value:  10 * time.Second,
+			EnvVar: "AUTHORIZATION_DENY_TTL",
+		},
+		cli.IntFlag{
+			Name:   "max-requests-inflight",
+			Usage:  "maximum number of requests in flight across all users, 0 for no limit",
+			Value:  100,
+			EnvVar: "MAX_REQUESTS_INFLIGHT",
+		},
+		cli.IntFlag{
+			Name:   "max-requests-inflight-per-user",
+			Usage:  "maximum number of requests in flight for a single user, 0 for no limit",
+			Value:  10,
+			EnvVar: "MAX_REQUESTS_INFLIGHT_PER_USER",
+		},
+		cli.Float64Flag{
+			Name:   "namespace-qps-per-user",
+			Usage:  "sustained number of namespaces a single user may query per second, 0 for no limit",
+			Value:  50,
+			EnvVar: "NAMESPACE_QPS_PER_USER",
+		},
+		cli.IntFlag{
+			Name:   "namespace-burst-per-user",
+			Usage:  "number of namespaces a single user may query at once",
+			Value:  500,
+			EnvVar: "NAMESPACE_BURST_PER_USER",
+		},
+		cli.Float64Flag{
+			Name:   "namespace-qps",
+			Usage:  "sustained number of namespaces all users together may query per second, 0 for no limit",
+			Value:  500,
+			EnvVar: "NAMESPACE_QPS",
+		},
+		cli.IntFlag{
+			Name:   "namespace-burst",
+			Usage:  "number of namespaces all users together may query at once",
+			Value:  5000,
+			EnvVar: "NAMESPACE_BURST",
+		},
+		cli.IntFlag{
+			Name:   "namespace-workers",
+			Usage:  "number of namespaces a single request queries at the same time",
+			Value:  3,
+			EnvVar: "NAMESPACE_WORKERS",
+		},
+		cli.StringSliceFlag{
+			Name:   "exclude-namespaces",
+			Usage:  "namespaces to leave out of all results",
+			EnvVar: "EXCLUDE_NAMESPACES",
+		},
+		cli.StringSliceFlag{
+			Name:   "exclude-namespace-patterns",
+			Usage:  "regular expressions matching the names of namespaces to leave out of all results",
+			EnvVar: "EXCLUDE_NAMESPACE_PATTERNS",
+		},
+		cli.StringFlag{
+			Name:   "exclude-namespace-selector",
+			Usage:  "label selector matching namespaces to leave out of all results",
+			EnvVar: "EXCLUDE_NAMESPACE_SELECTOR",
+		},
+		cli.StringFlag{
+			Name:   "redaction-config",
+			Usage:  "path to a file of rules for fields to redact from returned objects",
+			EnvVar: "REDACTION_CONFIG",
+		},
+		cli.StringFlag{
+			Name:   "audit-log-path",
+			Usage:  "file to write audit events to, or - for stdout, auditing is disabled if empty",
+			EnvVar: "AUDIT_LOG_PATH",
+		},
 		cli.StringFlag{
 			Name:   "kubeconfig",
 			Usage:  "path to kubeconfig",
@@ -114,68 +212,104 @@ func server(ctx context.Context, c *cli.Context, cfg *rest.Config) {
 	if err != nil {
 		logrus.Fatalf("could not start watcher: %v", err)
 	}
-	clientGetter := handlers.ClientGetter(cfg)
 	dynamicFactory, err := getDynamicInformerFactory(cfg)
 	if err != nil {
 		logrus.Fatal(err)
 	}
 	crdInformer, apiServiceInformer := setUpAPIInformers(dynamicFactory, ctx.Done())
 	apis := apiresources.WatchAPIResources(ctx, discovery, crdInformer, apiServiceInformer)
-	factory, err := getInformerFactory(cfg)
+	clientGetter := handlers.ClientGetter(cfg, apis)
+	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		logrus.Fatal(err)
 	}
+	factory := informers.NewSharedInformerFactory(clientset, 0)
 	namespaceCache, configMapCache, err := setUpInformers(factory, ctx.Done())
 	if err != nil {
 		logrus.Fatal(err)
 	}
+	clientCA := certs.NewClientCA(factory.Core().V1().ConfigMaps().Lister(), handlers.KubeSystemNamespace, handlers.ExtensionConfigMap, handlers.ClientCAKey)
+	if err := clientCA.Refresh(); err != nil {
+		logrus.Fatal(err)
+	}
+	clientCA.Watch(factory.Core().V1().ConfigMaps().Informer())
+	exclusions, err := policy.NewNamespaceExclusions(c.StringSlice("exclude-namespaces"), c.StringSlice("exclude-namespace-patterns"), c.String("exclude-namespace-selector"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	redactor, err := redaction.Load(c.String("redaction-config"))
+	if err != nil {
+		logrus.Fatal(err)
+	}
 	mux := mux.NewRouter()
 	mux.HandleFunc("/apis/resources.hns.demo/v1alpha1", handlers.DiscoveryHandler(apis))
-	mux.HandleFunc("/apis/resources.hns.demo/v1alpha1/{resource}", handlers.Forwarder(clientGetter, apis))
-	mux.HandleFunc("/apis/resources.hns.demo/v1alpha1/namespaces/{namespace}/{resource}", handlers.NamespaceHandler(clientGetter, apis, namespaceCache))
-	mux.Use(handlers.AuthenticateMiddleware(configMapCache))
+	mux.HandleFunc("/apis/resources.hns.demo/v1alpha1/{resource}", handlers.Forwarder(clientGetter, apis, namespaceCache, exclusions, redactor))
+	mux.HandleFunc("/apis/resources.hns.demo/v1alpha1/namespaces/{namespace}/{resource}", handlers.NamespaceHandler(clientGetter, apis, namespaceCache, exclusions, redactor))
+	mux.HandleFunc("/apis/resources.hns.demo/v1alpha1/namespaces/{namespace}/{resource}/{name}", handlers.NamespaceHandler(clientGetter, apis, namespaceCache, exclusions, redactor))
+	authorizer := authz.NewAuthorizer(clientset.AuthorizationV1().SubjectAccessReviews(), c.Duration("authorization-allow-ttl"), c.Duration("authorization-deny-ttl"))
+	mux.HandleFunc("/apis/resources.hns.demo/v1alpha1/mynamespaces/{resource}", handlers.MyNamespacesHandler(clientGetter, apis, namespaceCache, exclusions, redactor, authorizer)).Name(handlers.MyNamespacesRoute)
+	mux.Use(handlers.AuthenticateMiddleware(configMapCache, clientCA))
+	if auditLogPath := c.String("audit-log-path"); auditLogPath != "" {
+		auditLogger, err := audit.NewLogger(auditLogPath)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		mux.Use(audit.Middleware(auditLogger))
+	}
+	mux.Use(handlers.AuthorizeMiddleware(authorizer, apis))
+	// a burst of zero would quietly let every namespace query through
+	if c.Float64("namespace-qps-per-user") > 0 && c.Int("namespace-burst-per-user") < 1 {
+		logrus.Fatal("--namespace-burst-per-user must be at least 1 when --namespace-qps-per-user is set")
+	}
+	if c.Float64("namespace-qps") > 0 && c.Int("namespace-burst") < 1 {
+		logrus.Fatal("--namespace-burst must be at least 1 when --namespace-qps is set")
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		MaxInflight:           c.Int("max-requests-inflight"),
+		MaxInflightPerUser:    c.Int("max-requests-inflight-per-user"),
+		NamespaceQPSPerUser:   c.Float64("namespace-qps-per-user"),
+		NamespaceBurstPerUser: c.Int("namespace-burst-per-user"),
+		NamespaceQPS:          c.Float64("namespace-qps"),
+		NamespaceBurst:        c.Int("namespace-burst"),
+		NamespaceWorkers:      c.Int("namespace-workers"),
+	})
+	mux.Use(handlers.RateLimitMiddleware(limiter))
+	mux.Use(handlers.CompressionMiddleware())
 
 	address := c.String("host") + ":" + c.String("port")
-	clientCA, err := getClientCA(configMapCache)
+	servingCert, err := certs.NewServingCert(c.String("certpath"), c.String("keypath"))
 	if err != nil {
 		logrus.Fatal(err)
 	}
-	caCertPool := x509.NewCertPool()
-	caCertPool.AppendCertsFromPEM([]byte(clientCA))
+	go servingCert.Run(ctx)
 	tlsConfig := &tls.Config{
-		ClientCAs:  caCertPool,
-		ClientAuth: tls.RequireAndVerifyClientCert,
+		GetCertificate: servingCert.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		NextProtos:     []string{"h2", "http/1.1"},
 	}
+	tlsConfig.GetConfigForClient = clientCA.GetConfigForClient(tlsConfig.Clone())
 	server := http.Server{
 		Addr:      address,
 		Handler:   mux,
 		TLSConfig: tlsConfig,
 	}
+	if metricsPort := c.String("metrics-port"); metricsPort != "" {
+		go serveMetrics(net.JoinHostPort(c.String("metrics-host"), metricsPort))
+	}
 	logrus.Infof("starting server on %s", address)
-	err = server.ListenAndServeTLS(c.String("certpath"), c.String("keypath"))
+	err = server.ListenAndServeTLS("", "")
 	if err != nil {
 		logrus.Fatal(err)
 	}
 }
 
-func getClientCA(configMapCache corecache.ConfigMapNamespaceLister) (string, error) {
-	config, err := configMapCache.Get(handlers.ExtensionConfigMap)
-	if err != nil {
-		return "", err
-	}
-	clientCA, ok := config.Data[handlers.ClientCAKey]
-	if !ok {
-		return "", fmt.Errorf("invalid extension config")
-	}
-	return string(clientCA), nil
-}
-
-func getInformerFactory(cfg *rest.Config) (informers.SharedInformerFactory, error) {
-	clientset, err := kubernetes.NewForConfig(cfg)
-	if err != nil {
-		return nil, err
+func serveMetrics(address string) {
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	logrus.Infof("serving metrics on %s", address)
+	if err := http.ListenAndServe(address, metricsMux); err != nil {
+		logrus.Errorf("metrics server stopped: %v", err)
 	}
-	return informers.NewSharedInformerFactory(clientset, 0), nil
 }
 
 func getDynamicInformerFactory(cfg *rest.Config) (dynamicinformer.DynamicSharedInformerFactory, error) {
@@ -28,6 +28,7 @@ type APIResourceWatcher interface {
 	List() []metav1.APIResource
 	Get(resource, group string) (metav1.APIResource, bool)
 	GetKindForResource(gvr schema.GroupVersionResource) string
+	GetCategory(category string) []metav1.APIResource
 }
 
 type apiResourceWatcher struct {
@@ -38,6 +39,7 @@ type apiResourceWatcher struct {
 	apiResources []metav1.APIResource
 	gvrToKind    map[schema.GroupVersionResource]string
 	resourceMap  map[string]metav1.APIResource
+	categoryMap  map[string][]metav1.APIResource
 	retryQueue   workqueue.RateLimitingInterface
 }
 
@@ -48,6 +50,7 @@ func WatchAPIResources(ctx context.Context, discovery discovery.DiscoveryInterfa
 		client:      discovery,
 		gvrToKind:   make(map[schema.GroupVersionResource]string),
 		resourceMap: make(map[string]metav1.APIResource),
+		categoryMap: make(map[string][]metav1.APIResource),
 		retryQueue:  workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
 	}
 
@@ -130,6 +133,13 @@ func (a *apiResourceWatcher) Get(resource, group string) (metav1.APIResource, bo
 	return val, ok
 }
 
+// GetCategory returns the APIResources that belong to a category, such as "all".
+func (a *apiResourceWatcher) GetCategory(category string) []metav1.APIResource {
+	a.RLock()
+	defer a.RUnlock()
+	return a.categoryMap[category]
+}
+
 func (a *apiResourceWatcher) queueRefresh() {
 	atomic.StoreInt32(&a.toSync, 1)
 
@@ -149,6 +159,7 @@ func (a *apiResourceWatcher) setAPIResources() error {
 		return err
 	}
 	result := []metav1.APIResource{}
+	categories := make(map[string][]metav1.APIResource)
 	a.Lock()
 	defer a.Unlock()
 	for _, resource := range resourceList {
@@ -182,9 +193,15 @@ func (a *apiResourceWatcher) setAPIResources() error {
 			result = append(result, resource)
 			a.gvrToKind[schema.GroupVersionResource{Group: group, Version: version, Resource: r.Name}] = r.Kind
 			a.resourceMap[name] = resource
+			// categories are not advertised in discovery, so that kubectl does not include the hns resources
+			// when it expands a category itself
+			for _, category := range r.Categories {
+				categories[category] = append(categories[category], resource)
+			}
 		}
 	}
 	a.apiResources = result
+	a.categoryMap = categories
 	return nil
 }
 
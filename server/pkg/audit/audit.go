@@ -0,0 +1,170 @@
+// Package audit writes one structured event for every request handled by the extension server.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// auditIDHeader is the header the Kubernetes API server uses to pass the ID of the request in its own audit log.
+const auditIDHeader = "Audit-ID"
+
+type contextKey struct{}
+
+// Event is the audit record of a single request.
+type Event struct {
+	mu sync.Mutex
+
+	Timestamp         time.Time `json:"timestamp"`
+	AuditID           string    `json:"auditID,omitempty"`
+	User              string    `json:"user,omitempty"`
+	Groups            []string  `json:"groups,omitempty"`
+	Method            string    `json:"method"`
+	Path              string    `json:"path"`
+	Namespace         string    `json:"namespace,omitempty"`
+	Resource          string    `json:"resource,omitempty"`
+	LabelSelector     string    `json:"labelSelector,omitempty"`
+	FieldSelector     string    `json:"fieldSelector,omitempty"`
+	NamespaceSelector string    `json:"namespaceSelector,omitempty"`
+	Watch             bool      `json:"watch,omitempty"`
+	NamespacesQueried int       `json:"namespacesQueried"`
+	ItemsReturned     int       `json:"itemsReturned"`
+	LatencyMillis     int64     `json:"latencyMillis"`
+	Code              int       `json:"code"`
+	// Aborted is set if the handler panicked, such as a streamed list that failed after the response had started.
+	Aborted bool `json:"aborted,omitempty"`
+}
+
+// Logger writes audit events to a sink.
+type Logger struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewLogger creates a Logger that appends events to the file at path, or writes them to stdout if path is "-".
+func NewLogger(path string) (*Logger, error) {
+	if path == "-" {
+		return &Logger{out: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{out: f}, nil
+}
+
+// Middleware records an audit event for every request. It must run after authentication so that the user is known.
+// Requests that end in a panic, including aborted responses, are still recorded before the panic is passed on.
+func Middleware(logger *Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			query := r.URL.Query()
+			event := &Event{
+				Timestamp:         time.Now(),
+				AuditID:           r.Header.Get(auditIDHeader),
+				Method:            r.Method,
+				Path:              r.URL.Path,
+				Namespace:         vars["namespace"],
+				Resource:          vars["resource"],
+				LabelSelector:     query.Get("labelSelector"),
+				FieldSelector:     query.Get("fieldSelector"),
+				NamespaceSelector: query.Get("namespaceSelector"),
+				Watch:             query.Get("watch") == "true" || query.Get("watch") == "1",
+			}
+			if user, ok := request.UserFrom(r.Context()); ok {
+				event.User = user.GetName()
+				event.Groups = user.GetGroups()
+			}
+			rw := &responseWriter{ResponseWriter: w, code: http.StatusOK}
+			defer func() {
+				err := recover()
+				event.mu.Lock()
+				event.LatencyMillis = time.Since(event.Timestamp).Milliseconds()
+				event.Code = rw.code
+				if err != nil {
+					event.Aborted = true
+					if !rw.wroteHeader {
+						// the server closes the connection without a response
+						event.Code = http.StatusInternalServerError
+					}
+				}
+				event.mu.Unlock()
+				logger.write(event)
+				if err != nil {
+					panic(err)
+				}
+			}()
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), contextKey{}, event)))
+		})
+	}
+}
+
+// SetNamespacesQueried records how many namespaces the request was sent to.
+func SetNamespacesQueried(ctx context.Context, n int) {
+	if event, ok := ctx.Value(contextKey{}).(*Event); ok {
+		event.mu.Lock()
+		event.NamespacesQueried = n
+		event.mu.Unlock()
+	}
+}
+
+// AddItemsReturned adds to the number of items, table rows or watch events returned to the client.
+func AddItemsReturned(ctx context.Context, n int) {
+	if event, ok := ctx.Value(contextKey{}).(*Event); ok {
+		event.mu.Lock()
+		event.ItemsReturned += n
+		event.mu.Unlock()
+	}
+}
+
+func (l *Logger) write(event *Event) {
+	event.mu.Lock()
+	line, err := json.Marshal(event)
+	event.mu.Unlock()
+	if err != nil {
+		logrus.Errorf("could not encode audit event: %v", err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(append(line, '\n')); err != nil {
+		logrus.Errorf("could not write audit event: %v", err)
+	}
+}
+
+// responseWriter records the status code of the response.
+type responseWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.code = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so that watches can still be streamed.
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,82 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func serve(t *testing.T, handler http.HandlerFunc) (*Event, interface{}) {
+	t.Helper()
+	out := &bytes.Buffer{}
+	logger := &Logger{out: out}
+	r := httptest.NewRequest(http.MethodGet, "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets?labelSelector=app%3Dweb&fieldSelector=type%3DOpaque&namespaceSelector=env%3Dprod", nil)
+	w := httptest.NewRecorder()
+	var panicked interface{}
+	func() {
+		defer func() {
+			panicked = recover()
+		}()
+		Middleware(logger)(handler).ServeHTTP(w, r)
+	}()
+	event := &Event{}
+	if err := json.Unmarshal(out.Bytes(), event); err != nil {
+		t.Fatalf("invalid audit event %q: %v", out.String(), err)
+	}
+	return event, panicked
+}
+
+func TestMiddleware(t *testing.T) {
+	event, panicked := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		SetNamespacesQueried(r.Context(), 3)
+		AddItemsReturned(r.Context(), 2)
+		w.WriteHeader(http.StatusNotFound)
+	})
+	if panicked != nil {
+		t.Fatalf("unexpected panic: %v", panicked)
+	}
+	if event.Code != http.StatusNotFound || event.NamespacesQueried != 3 || event.ItemsReturned != 2 || event.Aborted {
+		t.Errorf("got code %d, %d namespaces, %d items and aborted %t", event.Code, event.NamespacesQueried, event.ItemsReturned, event.Aborted)
+	}
+	if event.LabelSelector != "app=web" || event.FieldSelector != "type=Opaque" || event.NamespaceSelector != "env=prod" {
+		t.Errorf("got label selector %q, field selector %q and namespace selector %q", event.LabelSelector, event.FieldSelector, event.NamespaceSelector)
+	}
+}
+
+func TestMiddlewareAborted(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		wantCode int
+	}{
+		{
+			name: "aborted after the response started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				AddItemsReturned(r.Context(), 1)
+				w.Write([]byte(`{"items":[`))
+				panic(http.ErrAbortHandler)
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name: "panicked before the response started",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("failed")
+			},
+			wantCode: http.StatusInternalServerError,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event, panicked := serve(t, test.handler)
+			if panicked == nil {
+				t.Errorf("expected the panic to be passed on")
+			}
+			if !event.Aborted || event.Code != test.wantCode {
+				t.Errorf("got code %d and aborted %t, want code %d and aborted", event.Code, event.Aborted, test.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package authz delegates authorization decisions to the Kubernetes API server with SubjectAccessReviews.
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apiserver/pkg/authentication/user"
+	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+const cacheSize = 10000
+
+// Authorizer decides whether a user may perform an action on a resource.
+type Authorizer interface {
+	// Authorize returns whether the user is allowed and, if the API server gave one, the reason for the decision.
+	Authorize(ctx context.Context, user user.Info, attributes authorizationv1.ResourceAttributes) (bool, string, error)
+}
+
+type subjectAccessReviewer struct {
+	client   authorizationclient.SubjectAccessReviewInterface
+	cache    *cache.LRUExpireCache
+	allowTTL time.Duration
+	denyTTL  time.Duration
+}
+
+type decision struct {
+	allowed bool
+	reason  string
+}
+
+// NewAuthorizer creates an Authorizer that sends a SubjectAccessReview for every decision that is not already cached.
+// Allowed and denied decisions are cached for allowTTL and denyTTL respectively.
+func NewAuthorizer(client authorizationclient.SubjectAccessReviewInterface, allowTTL, denyTTL time.Duration) Authorizer {
+	return &subjectAccessReviewer{
+		client:   client,
+		cache:    cache.NewLRUExpireCache(cacheSize),
+		allowTTL: allowTTL,
+		denyTTL:  denyTTL,
+	}
+}
+
+// Authorize implements Authorizer.Authorize.
+func (s *subjectAccessReviewer) Authorize(ctx context.Context, user user.Info, attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               user.GetName(),
+			UID:                user.GetUID(),
+			Groups:             user.GetGroups(),
+			Extra:              convertExtra(user.GetExtra()),
+		},
+	}
+	key, err := json.Marshal(review.Spec)
+	if err != nil {
+		return false, "", err
+	}
+	if cached, ok := s.cache.Get(string(key)); ok {
+		d := cached.(decision)
+		return d.allowed, d.reason, nil
+	}
+	result, err := s.client.Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	d := decision{
+		allowed: result.Status.Allowed,
+		reason:  result.Status.Reason,
+	}
+	if d.allowed {
+		s.cache.Add(string(key), d, s.allowTTL)
+	} else {
+		s.cache.Add(string(key), d, s.denyTTL)
+	}
+	return d.allowed, d.reason, nil
+}
+
+func convertExtra(extra map[string][]string) map[string]authorizationv1.ExtraValue {
+	if extra == nil {
+		return nil
+	}
+	converted := make(map[string]authorizationv1.ExtraValue, len(extra))
+	for k, v := range extra {
+		converted[k] = authorizationv1.ExtraValue(v)
+	}
+	return converted
+}
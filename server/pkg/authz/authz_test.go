@@ -0,0 +1,120 @@
+package authz
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+)
+
+// fakeReviewer allows lists and denies everything else, counting the reviews it receives.
+type fakeReviewer struct {
+	authorizationclient.SubjectAccessReviewInterface
+	reviews int
+}
+
+func (f *fakeReviewer) Create(_ context.Context, review *authorizationv1.SubjectAccessReview, _ metav1.CreateOptions) (*authorizationv1.SubjectAccessReview, error) {
+	f.reviews++
+	result := review.DeepCopy()
+	result.Status.Allowed = review.Spec.ResourceAttributes.Verb == "list"
+	if !result.Status.Allowed {
+		result.Status.Reason = "only lists are allowed"
+	}
+	return result, nil
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name        string
+		verb        string
+		user        string
+		allowTTL    time.Duration
+		denyTTL     time.Duration
+		wantAllowed bool
+		wantReason  string
+		// wantReviews is the number of reviews for two decisions on the same attributes
+		wantReviews int
+	}{
+		{
+			name:        "allowed and cached",
+			verb:        "list",
+			allowTTL:    time.Hour,
+			denyTTL:     time.Hour,
+			wantAllowed: true,
+			wantReviews: 1,
+		},
+		{
+			name:        "denied and cached",
+			verb:        "watch",
+			allowTTL:    time.Hour,
+			denyTTL:     time.Hour,
+			wantReason:  "only lists are allowed",
+			wantReviews: 1,
+		},
+		{
+			name:        "allowed after the allow TTL",
+			verb:        "list",
+			allowTTL:    time.Millisecond,
+			denyTTL:     time.Hour,
+			wantAllowed: true,
+			wantReviews: 2,
+		},
+		{
+			name:        "denied after the deny TTL",
+			verb:        "watch",
+			allowTTL:    time.Hour,
+			denyTTL:     time.Millisecond,
+			wantReason:  "only lists are allowed",
+			wantReviews: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reviewer := &fakeReviewer{}
+			authorizer := NewAuthorizer(reviewer, test.allowTTL, test.denyTTL)
+			attributes := authorizationv1.ResourceAttributes{Namespace: "a", Verb: test.verb, Resource: "secrets"}
+			for i := 0; i < 2; i++ {
+				allowed, reason, err := authorizer.Authorize(context.Background(), &user.DefaultInfo{Name: "alice"}, attributes)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if allowed != test.wantAllowed || reason != test.wantReason {
+					t.Errorf("got allowed %t with reason %q, want %t with %q", allowed, reason, test.wantAllowed, test.wantReason)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			if reviewer.reviews != test.wantReviews {
+				t.Errorf("got %d reviews, want %d", reviewer.reviews, test.wantReviews)
+			}
+		})
+	}
+}
+
+func TestAuthorizeCacheKey(t *testing.T) {
+	reviewer := &fakeReviewer{}
+	authorizer := NewAuthorizer(reviewer, time.Hour, time.Hour)
+	attributes := authorizationv1.ResourceAttributes{Namespace: "a", Verb: "list", Resource: "secrets"}
+	decisions := []struct {
+		user       user.Info
+		attributes authorizationv1.ResourceAttributes
+	}{
+		{user: &user.DefaultInfo{Name: "alice"}, attributes: attributes},
+		{user: &user.DefaultInfo{Name: "alice"}, attributes: attributes},
+		{user: &user.DefaultInfo{Name: "bob"}, attributes: attributes},
+		{user: &user.DefaultInfo{Name: "alice", Groups: []string{"admins"}}, attributes: attributes},
+		{user: &user.DefaultInfo{Name: "alice"}, attributes: authorizationv1.ResourceAttributes{Namespace: "b", Verb: "list", Resource: "secrets"}},
+	}
+	for _, decision := range decisions {
+		if _, _, err := authorizer.Authorize(context.Background(), decision.user, decision.attributes); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// only the repeated decision is cached, any other user, group or namespace is reviewed
+	if reviewer.reviews != 4 {
+		t.Errorf("got %d reviews, want 4", reviewer.reviews)
+	}
+}
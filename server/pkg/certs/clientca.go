@@ -0,0 +1,102 @@
+// Package certs provides TLS certificates that are reloaded while the server is running.
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	corecache "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ClientCA holds the pool of CAs used to verify client certificates, rebuilt from a ConfigMap whenever it changes.
+type ClientCA struct {
+	configMapCache corecache.ConfigMapNamespaceLister
+	namespace      string
+	name           string
+	key            string
+	pool           atomic.Pointer[x509.CertPool]
+}
+
+// NewClientCA creates a ClientCA that reads the CA bundle from the given key of the named ConfigMap.
+func NewClientCA(configMapCache corecache.ConfigMapLister, namespace, name, key string) *ClientCA {
+	return &ClientCA{
+		configMapCache: configMapCache.ConfigMaps(namespace),
+		namespace:      namespace,
+		name:           name,
+		key:            key,
+	}
+}
+
+// Watch registers an event handler on the ConfigMap informer so that the CA pool is rebuilt when the ConfigMap changes.
+func (c *ClientCA) Watch(informer cache.SharedIndexInformer) {
+	informer.AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: c.isClientCAConfigMap,
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.onAdd,
+			UpdateFunc: c.onUpdate,
+		},
+	})
+}
+
+// Refresh reads the CA bundle from the ConfigMap cache and replaces the current pool.
+// The current pool is kept if the bundle cannot be read or contains no certificates.
+func (c *ClientCA) Refresh() error {
+	config, err := c.configMapCache.Get(c.name)
+	if err != nil {
+		return err
+	}
+	clientCA, ok := config.Data[c.key]
+	if !ok {
+		return fmt.Errorf("invalid extension config, missing %s", c.key)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(clientCA)) {
+		return fmt.Errorf("invalid extension config, no certificates found in %s", c.key)
+	}
+	c.pool.Store(pool)
+	return nil
+}
+
+// Pool returns the current CA pool.
+func (c *ClientCA) Pool() *x509.CertPool {
+	return c.pool.Load()
+}
+
+// GetConfigForClient returns a function for tls.Config.GetConfigForClient which uses the current CA pool for every
+// new connection.
+func (c *ClientCA) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		config := base.Clone()
+		config.ClientCAs = c.Pool()
+		return config, nil
+	}
+}
+
+func (c *ClientCA) isClientCAConfigMap(obj interface{}) bool {
+	configMap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return false
+	}
+	return configMap.Namespace == c.namespace && configMap.Name == c.name
+}
+
+func (c *ClientCA) onAdd(_ interface{}) {
+	c.refresh()
+}
+
+func (c *ClientCA) onUpdate(_, _ interface{}) {
+	c.refresh()
+}
+
+func (c *ClientCA) refresh() {
+	if err := c.Refresh(); err != nil {
+		logrus.Errorf("failed to reload client CA, keeping the current one: %v", err)
+		return
+	}
+	logrus.Infof("reloaded client CA from %s", c.name)
+}
@@ -0,0 +1,140 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corecache "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	testNamespace = "kube-system"
+	testName      = "extension-apiserver-authentication"
+	testKey       = "requestheader-client-ca-file"
+)
+
+// selfSigned returns a new self-signed CA certificate and its key, PEM encoded.
+func selfSigned(t *testing.T, commonName string) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func caConfigMap(data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName}, Data: data}
+}
+
+func testClientCA(t *testing.T, configMap *corev1.ConfigMap) (*ClientCA, cache.Indexer) {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	indexer.Add(configMap)
+	return NewClientCA(corecache.NewConfigMapLister(indexer), testNamespace, testName, testKey), indexer
+}
+
+// trusts returns whether the pool verifies the PEM encoded CA certificate.
+func trusts(pool *x509.CertPool, certPEM []byte) bool {
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false
+	}
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	return err == nil
+}
+
+func TestClientCAGetConfigForClient(t *testing.T) {
+	oldCA, _ := selfSigned(t, "old")
+	newCA, _ := selfSigned(t, "new")
+	clientCA, indexer := testClientCA(t, caConfigMap(map[string]string{testKey: string(oldCA)}))
+	if err := clientCA.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	base := &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert}
+	getConfig := clientCA.GetConfigForClient(base)
+	config, _ := getConfig(nil)
+	if !trusts(config.ClientCAs, oldCA) {
+		t.Errorf("expected the old CA to be trusted")
+	}
+
+	indexer.Update(caConfigMap(map[string]string{testKey: string(newCA)}))
+	if err := clientCA.Refresh(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config, _ = getConfig(nil)
+	if !trusts(config.ClientCAs, newCA) || trusts(config.ClientCAs, oldCA) {
+		t.Errorf("expected only the new CA to be trusted")
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || base.ClientCAs != nil {
+		t.Errorf("expected the config to be a copy of the base config")
+	}
+}
+
+func TestClientCAFailedRefresh(t *testing.T) {
+	ca, _ := selfSigned(t, "ca")
+	tests := []struct {
+		name   string
+		update func(cache.Indexer)
+	}{
+		{
+			name:   "missing key",
+			update: func(indexer cache.Indexer) { indexer.Update(caConfigMap(map[string]string{})) },
+		},
+		{
+			name: "no certificates",
+			update: func(indexer cache.Indexer) {
+				indexer.Update(caConfigMap(map[string]string{testKey: "not a certificate"}))
+			},
+		},
+		{
+			name:   "deleted ConfigMap",
+			update: func(indexer cache.Indexer) { indexer.Delete(caConfigMap(nil)) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientCA, indexer := testClientCA(t, caConfigMap(map[string]string{testKey: string(ca)}))
+			if err := clientCA.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			test.update(indexer)
+			if err := clientCA.Refresh(); err == nil {
+				t.Errorf("expected an error")
+			}
+			if !trusts(clientCA.Pool(), ca) {
+				t.Errorf("expected the previous CA to be kept")
+			}
+		})
+	}
+}
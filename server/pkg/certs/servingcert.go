@@ -0,0 +1,82 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cmurphy/hns-list/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var servingCertCheckPeriod = 10 * time.Second
+
+// ServingCert serves the key pair stored at the given paths and reloads it when the files change on disk.
+type ServingCert struct {
+	certPath string
+	keyPath  string
+	certPEM  []byte
+	keyPEM   []byte
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// NewServingCert loads the key pair from the given paths.
+func NewServingCert(certPath, keyPath string) (*ServingCert, error) {
+	s := &ServingCert{
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run checks the certificate files for changes until the context is done.
+func (s *ServingCert) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, s.reload, servingCertCheckPeriod)
+}
+
+// GetCertificate implements tls.Config.GetCertificate and returns the most recently loaded key pair.
+func (s *ServingCert) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.cert.Load(), nil
+}
+
+func (s *ServingCert) reload(_ context.Context) {
+	changed, err := s.load()
+	if err != nil {
+		logrus.Errorf("failed to reload serving certificate, keeping the current one: %v", err)
+		return
+	}
+	if changed {
+		metrics.ServingCertRotations.Inc()
+		logrus.Infof("reloaded serving certificate from %s", s.certPath)
+	}
+}
+
+// load reads the key pair from disk and replaces the current certificate if either file changed.
+func (s *ServingCert) load() (bool, error) {
+	certPEM, err := os.ReadFile(s.certPath)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(s.keyPath)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(certPEM, s.certPEM) && bytes.Equal(keyPEM, s.keyPEM) {
+		return false, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	s.certPEM = certPEM
+	s.keyPEM = keyPEM
+	s.cert.Store(&cert)
+	return true, nil
+}
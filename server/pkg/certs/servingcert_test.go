@@ -0,0 +1,87 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cmurphy/hns-list/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func writeKeyPair(t *testing.T, dir string, certPEM, keyPEM []byte) (string, string) {
+	t.Helper()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+// assertServing checks that the serving certificate is the PEM encoded one.
+func assertServing(t *testing.T, s *ServingCert, certPEM []byte) {
+	t.Helper()
+	cert, err := s.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if !bytes.Equal(cert.Certificate[0], block.Bytes) {
+		t.Errorf("got the wrong serving certificate")
+	}
+}
+
+func TestServingCertRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldCert, oldKey := selfSigned(t, "old")
+	certPath, keyPath := writeKeyPair(t, dir, oldCert, oldKey)
+	s, err := NewServingCert(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertServing(t, s, oldCert)
+	rotations := testutil.ToFloat64(metrics.ServingCertRotations)
+
+	// unchanged files are not a rotation
+	s.reload(context.Background())
+	if got := testutil.ToFloat64(metrics.ServingCertRotations); got != rotations {
+		t.Errorf("got %v rotations, want %v", got, rotations)
+	}
+
+	newCert, newKey := selfSigned(t, "new")
+	writeKeyPair(t, dir, newCert, newKey)
+	s.reload(context.Background())
+	assertServing(t, s, newCert)
+	if got := testutil.ToFloat64(metrics.ServingCertRotations); got != rotations+1 {
+		t.Errorf("got %v rotations, want %v", got, rotations+1)
+	}
+}
+
+func TestServingCertInvalid(t *testing.T) {
+	dir := t.TempDir()
+	oldCert, oldKey := selfSigned(t, "old")
+	newCert, _ := selfSigned(t, "new")
+
+	if _, err := NewServingCert(writeKeyPair(t, dir, newCert, oldKey)); err == nil {
+		t.Errorf("expected a mismatched key pair to be rejected")
+	}
+
+	s, err := NewServingCert(writeKeyPair(t, dir, oldCert, oldKey))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rotations := testutil.ToFloat64(metrics.ServingCertRotations)
+	// a new certificate without its key
+	writeKeyPair(t, dir, newCert, oldKey)
+	s.reload(context.Background())
+	assertServing(t, s, oldCert)
+	if got := testutil.ToFloat64(metrics.ServingCertRotations); got != rotations {
+		t.Errorf("got %v rotations, want %v", got, rotations)
+	}
+}
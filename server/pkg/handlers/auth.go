@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/cmurphy/hns-list/pkg/authz"
+	"github.com/cmurphy/hns-list/pkg/certs"
+	"github.com/cmurphy/hns-list/pkg/consts"
+	"github.com/cmurphy/hns-list/pkg/redaction"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/request/headerrequest"
+	x509request "k8s.io/apiserver/pkg/authentication/request/x509"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	corecache "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// redactParam is the query parameter used to ask for unredacted objects.
+	redactParam = "redact"
+	// unredactVerb is the verb needed to see objects unredacted, so that no built-in role grants it.
+	unredactVerb = "unredact"
+)
+
+// requestHeaderConfig is the front proxy configuration from the extension-apiserver-authentication ConfigMap.
+type requestHeaderConfig struct {
+	allowedNames        []string
+	usernameHeaders     []string
+	groupHeaders        []string
+	extraHeaderPrefixes []string
+}
+
+// AuthenticateMiddleware authenticates the front proxy and stores the user from the request headers in the context.
+func AuthenticateMiddleware(configMapCache corecache.ConfigMapNamespaceLister, clientCA *certs.ClientCA) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			config, err := getRequestHeaderConfig(configMapCache)
+			if err != nil {
+				logrus.Errorf("could not authenticate API server, err: %v", err)
+				http.Error(w, fmt.Sprintf("could not authenticate API server, error: %v", err), http.StatusInternalServerError)
+				return
+			}
+			verifyOptions := func() (x509.VerifyOptions, bool) {
+				return x509.VerifyOptions{
+					Roots:     clientCA.Pool(),
+					KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+				}, true
+			}
+			authenticator := headerrequest.NewDynamicVerifyOptionsSecure(
+				x509request.VerifyOptionFunc(verifyOptions),
+				headerrequest.StaticStringSlice(config.allowedNames),
+				headerrequest.StaticStringSlice(config.usernameHeaders),
+				headerrequest.StaticStringSlice(config.groupHeaders),
+				headerrequest.StaticStringSlice(config.extraHeaderPrefixes),
+			)
+			resp, ok, err := authenticator.AuthenticateRequest(r)
+			if err != nil {
+				logrus.Warnf("user is not authenticated: %v", err)
+				http.Error(w, fmt.Sprintf("user is not authenticated: %v", err), http.StatusUnauthorized)
+				return
+			}
+			if !ok {
+				logrus.Warnf("user is not authenticated")
+				http.Error(w, "user is not authenticated", http.StatusUnauthorized)
+				return
+			}
+			logrus.Tracef("authenticated user %s", resp.User.GetName())
+			next.ServeHTTP(w, r.WithContext(request.WithUser(r.Context(), resp.User)))
+		})
+	}
+}
+
+func getRequestHeaderConfig(configMapCache corecache.ConfigMapNamespaceLister) (*requestHeaderConfig, error) {
+	configMap, err := configMapCache.Get(ExtensionConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	config := &requestHeaderConfig{}
+	fields := map[string]*[]string{
+		AllowedCNKey:       &config.allowedNames,
+		UsernameHeadersKey: &config.usernameHeaders,
+		GroupHeadersKey:    &config.groupHeaders,
+		ExtraHeadersKey:    &config.extraHeaderPrefixes,
+	}
+	for key, field := range fields {
+		value := configMap.Data[key]
+		// a missing key is the same as an empty list, as it is for the Kubernetes API server
+		if value == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(value), field); err != nil {
+			return nil, fmt.Errorf("invalid extension config, could not parse %s: %w", key, err)
+		}
+	}
+	return config, nil
+}
+
+// AuthorizeMiddleware checks that the user may use the requested resources in the resources.hns.demo group.
+func AuthorizeMiddleware(authorizer authz.Authorizer, apis apiresources.APIResourceWatcher) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vars := mux.Vars(r)
+			resource, ok := vars["resource"]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			user, ok := request.UserFrom(r.Context())
+			if !ok {
+				isErrorAndHandleError(w, apierrors.NewUnauthorized(errNoUser.Error()))
+				return
+			}
+			namespaces := subtreeRoots(r)
+			if len(namespaces) == 0 {
+				namespaces = []string{""}
+			}
+			redact, err := strconv.ParseBool(r.URL.Query().Get(redactParam))
+			unredacted := err == nil && !redact
+			for _, resource := range resourceNames(resource, apis) {
+				attributes := authorizationv1.ResourceAttributes{
+					Verb:     requestVerb(r),
+					Group:    consts.Group,
+					Version:  consts.Version,
+					Resource: resource,
+					Name:     vars["name"],
+				}
+				if route := mux.CurrentRoute(r); route == nil || route.GetName() != MyNamespacesRoute {
+					if !authorizeNamespaces(w, r, authorizer, user, attributes, namespaces) {
+						return
+					}
+				}
+				if unredacted {
+					attributes.Verb = unredactVerb
+					attributes.Name = ""
+					if !authorizeNamespaces(w, r, authorizer, user, attributes, namespaces) {
+						return
+					}
+				}
+			}
+			if unredacted {
+				r = r.WithContext(redaction.WithoutRedaction(r.Context()))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// authorizeNamespaces writes a forbidden response and returns false unless every namespace is allowed.
+func authorizeNamespaces(w http.ResponseWriter, r *http.Request, authorizer authz.Authorizer, user user.Info, attributes authorizationv1.ResourceAttributes, namespaces []string) bool {
+	for _, namespace := range namespaces {
+		attributes.Namespace = namespace
+		allowed, reason, err := authorizer.Authorize(r.Context(), user, attributes)
+		if err != nil {
+			logrus.Errorf("could not authorize user %s, err: %v", user.GetName(), err)
+			isErrorAndHandleError(w, apierrors.NewInternalError(fmt.Errorf("could not authorize user: %w", err)))
+			return false
+		}
+		if !allowed {
+			logrus.Debugf("user %s is not allowed to %s %s in namespace %q: %s", user.GetName(), attributes.Verb, attributes.Resource, namespace, reason)
+			isErrorAndHandleError(w, apierrors.NewForbidden(schema.GroupResource{Group: consts.Group, Resource: attributes.Resource}, attributes.Name, errors.New(reason)))
+			return false
+		}
+	}
+	return true
+}
+
+// requestVerb returns watch, get for a single name, or list.
+func requestVerb(r *http.Request) string {
+	if watch, _ := strconv.ParseBool(r.URL.Query().Get("watch")); watch {
+		return "watch"
+	}
+	if _, ok := mux.Vars(r)["name"]; ok {
+		return "get"
+	}
+	return "list"
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cmurphy/hns-list/pkg/certs"
+	"github.com/cmurphy/hns-list/pkg/consts"
+	"github.com/cmurphy/hns-list/pkg/redaction"
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	corecache "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// authorizedRouter serves the hierarchical routes behind AuthorizeMiddleware. Every route writes whether the
+// request may see unredacted objects.
+func authorizedRouter(authorizer *fakeAuthorizer) *mux.Router {
+	redactor, _ := redaction.New(redaction.Config{Rules: []redaction.Rule{{Resource: "secrets", Paths: []string{"data"}}}})
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		obj := map[string]interface{}{"data": "secret"}
+		redactor.Redact(r.Context(), secretsResource, obj)
+		w.Write([]byte(obj["data"].(string)))
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/apis/resources.hns.demo/v1alpha1", handler)
+	router.HandleFunc("/apis/resources.hns.demo/v1alpha1/{resource}", handler)
+	router.HandleFunc("/apis/resources.hns.demo/v1alpha1/namespaces/{namespace}/{resource}", handler)
+	router.HandleFunc("/apis/resources.hns.demo/v1alpha1/namespaces/{namespace}/{resource}/{name}", handler)
+	router.HandleFunc("/apis/resources.hns.demo/v1alpha1/mynamespaces/{resource}", handler).Name(MyNamespacesRoute)
+	router.Use(AuthorizeMiddleware(authorizer, fakeAPIs{}))
+	return router
+}
+
+func TestAuthorizeMiddleware(t *testing.T) {
+	const prefix = "/apis/resources.hns.demo/v1alpha1"
+	group := "/" + consts.Group + "/"
+	tests := []struct {
+		name      string
+		path      string
+		allowed   []string
+		noUser    bool
+		wantCode  int
+		wantCalls []string
+		// wantUnredacted is whether the handler may return unredacted objects
+		wantUnredacted bool
+	}{
+		{
+			name:      "cluster-wide list",
+			path:      "/secrets",
+			allowed:   []string{group + "secrets/list"},
+			wantCode:  http.StatusOK,
+			wantCalls: []string{group + "secrets/list"},
+		},
+		{
+			name:      "cluster-wide list forbidden",
+			path:      "/secrets",
+			wantCode:  http.StatusForbidden,
+			wantCalls: []string{group + "secrets/list"},
+		},
+		{
+			name:      "watch",
+			path:      "/namespaces/a/secrets?watch=true",
+			allowed:   []string{"a" + group + "secrets/watch"},
+			wantCode:  http.StatusOK,
+			wantCalls: []string{"a" + group + "secrets/watch"},
+		},
+		{
+			name:      "get by name",
+			path:      "/namespaces/a/secrets/s1",
+			allowed:   []string{"a" + group + "secrets/get"},
+			wantCode:  http.StatusOK,
+			wantCalls: []string{"a" + group + "secrets/get"},
+		},
+		{
+			name:      "every root",
+			path:      "/namespaces/a,b/secrets?root=c",
+			allowed:   []string{"a" + group + "secrets/list", "b" + group + "secrets/list", "c" + group + "secrets/list"},
+			wantCode:  http.StatusOK,
+			wantCalls: []string{"a" + group + "secrets/list", "b" + group + "secrets/list", "c" + group + "secrets/list"},
+		},
+		{
+			name:      "one root forbidden",
+			path:      "/namespaces/a,b,c/secrets",
+			allowed:   []string{"a" + group + "secrets/list", "c" + group + "secrets/list"},
+			wantCode:  http.StatusForbidden,
+			wantCalls: []string{"a" + group + "secrets/list", "b" + group + "secrets/list"},
+		},
+		{
+			name:      "every resource of a category",
+			path:      "/namespaces/a/all",
+			allowed:   []string{"a" + group + "secrets/list", "a" + group + "configmaps/list"},
+			wantCode:  http.StatusOK,
+			wantCalls: []string{"a" + group + "secrets/list", "a" + group + "configmaps/list"},
+		},
+		{
+			name:      "one resource forbidden",
+			path:      "/namespaces/a/secrets,configmaps",
+			allowed:   []string{"a" + group + "secrets/list"},
+			wantCode:  http.StatusForbidden,
+			wantCalls: []string{"a" + group + "secrets/list", "a" + group + "configmaps/list"},
+		},
+		{
+			name:     "my namespaces are authorized by the handler",
+			path:     "/mynamespaces/secrets",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:           "unredacted",
+			path:           "/namespaces/a/secrets?redact=false",
+			allowed:        []string{"a" + group + "secrets/list", "a" + group + "secrets/unredact"},
+			wantCode:       http.StatusOK,
+			wantCalls:      []string{"a" + group + "secrets/list", "a" + group + "secrets/unredact"},
+			wantUnredacted: true,
+		},
+		{
+			name:      "unredacted forbidden",
+			path:      "/namespaces/a/secrets?redact=false",
+			allowed:   []string{"a" + group + "secrets/list"},
+			wantCode:  http.StatusForbidden,
+			wantCalls: []string{"a" + group + "secrets/list", "a" + group + "secrets/unredact"},
+		},
+		{
+			name:           "my namespaces unredacted",
+			path:           "/mynamespaces/secrets?redact=false",
+			allowed:        []string{group + "secrets/unredact"},
+			wantCode:       http.StatusOK,
+			wantCalls:      []string{group + "secrets/unredact"},
+			wantUnredacted: true,
+		},
+		{
+			name:     "discovery",
+			path:     "",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "no user",
+			path:     "/secrets",
+			noUser:   true,
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			authorizer := &fakeAuthorizer{allowed: map[string]bool{}}
+			for _, key := range test.allowed {
+				authorizer.allowed[key] = true
+			}
+			r := httptest.NewRequest(http.MethodGet, prefix+test.path, nil)
+			if !test.noUser {
+				r = r.WithContext(request.WithUser(context.Background(), &user.DefaultInfo{Name: "alice"}))
+			}
+			w := httptest.NewRecorder()
+			authorizedRouter(authorizer).ServeHTTP(w, r)
+			if w.Code != test.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, test.wantCode, w.Body.String())
+			}
+			if len(authorizer.calls) > 0 || len(test.wantCalls) > 0 {
+				if !reflect.DeepEqual(authorizer.calls, test.wantCalls) {
+					t.Errorf("got access reviews %v, want %v", authorizer.calls, test.wantCalls)
+				}
+			}
+			if w.Code != http.StatusOK {
+				status := metav1.Status{}
+				if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || status.Kind != "Status" || int(status.Code) != test.wantCode {
+					t.Errorf("expected a Status with code %d, got %s", test.wantCode, w.Body.String())
+				}
+				return
+			}
+			if unredacted := w.Body.String() == "secret"; unredacted != test.wantUnredacted {
+				t.Errorf("got unredacted %t, want %t", unredacted, test.wantUnredacted)
+			}
+		})
+	}
+}
+
+// testCertificate returns a new certificate with the common name and its key, signed by the parent or self-signed if
+// the parent is nil.
+func testCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestAuthenticateMiddleware(t *testing.T) {
+	ca, caKey := testCertificate(t, "front-proxy-ca", nil, nil)
+	untrustedCA, untrustedKey := testCertificate(t, "other-ca", nil, nil)
+	frontProxy, _ := testCertificate(t, "front-proxy", ca, caKey)
+	otherClient, _ := testCertificate(t, "other-client", ca, caKey)
+	untrusted, _ := testCertificate(t, "front-proxy", untrustedCA, untrustedKey)
+
+	defaultHeaders := map[string]string{
+		UsernameHeadersKey: `["X-Remote-User"]`,
+		GroupHeadersKey:    `["X-Remote-Group"]`,
+		ExtraHeadersKey:    `["X-Remote-Extra-"]`,
+	}
+	tests := []struct {
+		name         string
+		config       map[string]string
+		allowedNames string
+		cert         *x509.Certificate
+		headers      map[string][]string
+		wantCode     int
+		wantUser     *user.DefaultInfo
+	}{
+		{
+			name:     "no client certificate",
+			config:   defaultHeaders,
+			headers:  map[string][]string{"X-Remote-User": {"alice"}},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "untrusted CA",
+			config:   defaultHeaders,
+			cert:     untrusted,
+			headers:  map[string][]string{"X-Remote-User": {"alice"}},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "any name allowed",
+			config:   defaultHeaders,
+			cert:     otherClient,
+			headers:  map[string][]string{"X-Remote-User": {"alice"}, "X-Remote-Group": {"devs", "admins"}},
+			wantCode: http.StatusOK,
+			wantUser: &user.DefaultInfo{Name: "alice", Groups: []string{"devs", "admins"}, Extra: map[string][]string{}},
+		},
+		{
+			name:         "name not allowed",
+			config:       defaultHeaders,
+			allowedNames: `["front-proxy"]`,
+			cert:         otherClient,
+			headers:      map[string][]string{"X-Remote-User": {"alice"}},
+			wantCode:     http.StatusUnauthorized,
+		},
+		{
+			name:         "name allowed",
+			config:       defaultHeaders,
+			allowedNames: `["front-proxy"]`,
+			cert:         frontProxy,
+			headers:      map[string][]string{"X-Remote-User": {"alice"}},
+			wantCode:     http.StatusOK,
+			wantUser:     &user.DefaultInfo{Name: "alice", Groups: []string{}, Extra: map[string][]string{}},
+		},
+		{
+			name: "custom headers",
+			config: map[string]string{
+				UsernameHeadersKey: `["X-Custom-User"]`,
+				GroupHeadersKey:    `["X-Custom-Group"]`,
+				ExtraHeadersKey:    `["X-Custom-Extra-"]`,
+			},
+			cert: frontProxy,
+			headers: map[string][]string{
+				"X-Remote-User":                     {"mallory"},
+				"X-Custom-User":                     {"alice"},
+				"X-Custom-Group":                    {"devs"},
+				"X-Custom-Extra-Scopes":             {"read", "write"},
+				"X-Custom-Extra-Example.com%2fteam": {"a"},
+			},
+			wantCode: http.StatusOK,
+			wantUser: &user.DefaultInfo{Name: "alice", Groups: []string{"devs"}, Extra: map[string][]string{"scopes": {"read", "write"}, "example.com/team": {"a"}}},
+		},
+		{
+			name:     "missing user header",
+			config:   defaultHeaders,
+			cert:     frontProxy,
+			headers:  map[string][]string{"X-Remote-Group": {"devs"}},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := map[string]string{ClientCAKey: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}))}
+			for key, value := range test.config {
+				data[key] = value
+			}
+			if test.allowedNames != "" {
+				data[AllowedCNKey] = test.allowedNames
+			}
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			indexer.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: KubeSystemNamespace, Name: ExtensionConfigMap}, Data: data})
+			configMaps := corecache.NewConfigMapLister(indexer)
+			clientCA := certs.NewClientCA(configMaps, KubeSystemNamespace, ExtensionConfigMap, ClientCAKey)
+			if err := clientCA.Refresh(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var authenticated user.Info
+			handler := AuthenticateMiddleware(configMaps.ConfigMaps(KubeSystemNamespace), clientCA)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authenticated, _ = request.UserFrom(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/apis/resources.hns.demo/v1alpha1/secrets", nil)
+			r.TLS = &tls.ConnectionState{}
+			if test.cert != nil {
+				r.TLS.PeerCertificates = []*x509.Certificate{test.cert}
+			}
+			for header, values := range test.headers {
+				for _, value := range values {
+					r.Header.Add(header, value)
+				}
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, test.wantCode, w.Body.String())
+			}
+			if test.wantUser == nil {
+				if authenticated != nil {
+					t.Errorf("expected no user, got %+v", authenticated)
+				}
+				return
+			}
+			if authenticated == nil {
+				t.Fatalf("expected user %+v, got none", test.wantUser)
+			}
+			got := &user.DefaultInfo{Name: authenticated.GetName(), Groups: authenticated.GetGroups(), Extra: authenticated.GetExtra()}
+			if !reflect.DeepEqual(got, test.wantUser) {
+				t.Errorf("got user %+v, want %+v", got, test.wantUser)
+			}
+		})
+	}
+}
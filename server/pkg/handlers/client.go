@@ -1,17 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
+	"github.com/cmurphy/hns-list/pkg/apiresources"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/endpoints/handlers/negotiation"
+	"k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 )
 
-var errUnsupportedContentType = errors.New("could not negotiate content type")
+var (
+	errUnsupportedContentType = errors.New("could not negotiate content type")
+	errNoUser                 = errors.New("no user found in request")
+)
 
 // clientGetter returns a dynamic client with the request's Accept headers passed through.
 type clientGetter func(*http.Request, schema.GroupVersionResource) (dynamic.NamespaceableResourceInterface, error)
@@ -24,13 +30,14 @@ func (e endpointRestrictions) AllowsMediaTypeTransform(mimeType string, mimeSubT
 	if mimeType != "application" {
 		return false
 	}
-	if mimeSubType != "json" {
+	if mimeSubType != "json" && mimeSubType != "vnd.kubernetes.protobuf" {
 		return false
 	}
-	if gvk == nil || gvk.Kind == "" || gvk.Kind == "Table" {
+	if gvk == nil || gvk.Kind == "" {
 		return true
 	}
-	return false
+	// Tables have no protobuf encoding
+	return mimeSubType == "json" && gvk.Kind == "Table"
 }
 
 // AllowsServerVersion implements negotiation.EndpointRestrictions.AllowsServerVersion.
@@ -43,24 +50,20 @@ func (e endpointRestrictions) AllowsStreamSchema(string) bool {
 	return true
 }
 
-// ClientGetter sets up a roundtripper for the dynamic client and returns the interface for the given resource.
-// The dynamic client ignores the AcceptContentType field on the rest config, so we need to make sure it is set on
-// the round tripper in order to retrieve Table-formatted data.
-func ClientGetter(restConfig *rest.Config) clientGetter {
+// ClientGetter returns a dynamic client for the resource that impersonates the requesting user.
+func ClientGetter(restConfig *rest.Config, apis apiresources.APIResourceWatcher) clientGetter {
 	return func(r *http.Request, resource schema.GroupVersionResource) (dynamic.NamespaceableResourceInterface, error) {
-		acceptedTypes := []runtime.SerializerInfo{
-			{
-				MediaType:        "application/json",
-				MediaTypeType:    "application",
-				MediaTypeSubType: "json",
-			},
-		}
-		mediaType, ok := negotiation.NegotiateMediaTypeOptions(r.Header.Get("Accept"), acceptedTypes, endpointRestrictions{})
+		mediaType, ok := negotiate(r, protobufSupported(resource, apis))
 		if !ok {
 			return nil, errUnsupportedContentType
 		}
+		impersonate, err := impersonationConfig(r)
+		if err != nil {
+			return nil, err
+		}
 		cfg := rest.CopyConfig(restConfig)
-		setOptions := roundTripper(mediaType)
+		cfg.Impersonate = impersonate
+		setOptions := roundTripper(mediaType, upstreamIncludeObject(r))
 		cfg.Wrap(setOptions)
 		dynamicClient, err := dynamic.NewForConfig(cfg)
 		if err != nil {
@@ -70,6 +73,40 @@ func ClientGetter(restConfig *rest.Config) clientGetter {
 	}
 }
 
+// impersonationConfig impersonates the user that AuthenticateMiddleware stored in the request context.
+func impersonationConfig(r *http.Request) (rest.ImpersonationConfig, error) {
+	user, ok := request.UserFrom(r.Context())
+	if !ok || user.GetName() == "" {
+		return rest.ImpersonationConfig{}, errNoUser
+	}
+	return rest.ImpersonationConfig{
+		UserName: user.GetName(),
+		Groups:   user.GetGroups(),
+		Extra:    user.GetExtra(),
+	}, nil
+}
+
+// clientErrorStatus returns the HTTP status code for an error returned by a clientGetter.
+func clientErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNoUser):
+		return http.StatusUnauthorized
+	case errors.Is(err, errUnsupportedContentType):
+		return http.StatusNotAcceptable
+	}
+	return http.StatusInternalServerError
+}
+
+// metadataOnlyAccept asks the Kubernetes API server for lists of only the metadata of the objects.
+const metadataOnlyAccept = runtime.ContentTypeJSON + ";as=PartialObjectMetadataList;v=v1;g=meta.k8s.io"
+
+type metadataOnlyKey struct{}
+
+// withMetadataOnly returns a context for client requests that only need object metadata.
+func withMetadataOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, metadataOnlyKey{}, true)
+}
+
 type addOptions struct {
 	accept string
 	query  map[string]string
@@ -77,6 +114,10 @@ type addOptions struct {
 }
 
 func (a *addOptions) RoundTrip(r *http.Request) (*http.Response, error) {
+	if metadataOnly, _ := r.Context().Value(metadataOnlyKey{}).(bool); metadataOnly {
+		r.Header.Set("Accept", metadataOnlyAccept)
+		return a.next.RoundTrip(r)
+	}
 	r.Header.Set("Accept", a.accept)
 	q := r.URL.Query()
 	for k, v := range a.query {
@@ -86,8 +127,12 @@ func (a *addOptions) RoundTrip(r *http.Request) (*http.Response, error) {
 	return a.next.RoundTrip(r)
 }
 
-func roundTripper(mediaType negotiation.MediaTypeOptions) func(http.RoundTripper) http.RoundTripper {
+// roundTripper sets the Accept header and includeObject parameter on every request.
+func roundTripper(mediaType negotiation.MediaTypeOptions, includeObject string) func(http.RoundTripper) http.RoundTripper {
 	accept := mediaType.Accepted.MediaType
+	if accept == runtime.ContentTypeProtobuf {
+		accept = runtime.ContentTypeJSON
+	}
 	if mediaType.Convert != nil {
 		if mediaType.Convert.Kind != "" {
 			accept += ";as=" + mediaType.Convert.Kind
@@ -104,9 +149,9 @@ func roundTripper(mediaType negotiation.MediaTypeOptions) func(http.RoundTripper
 			accept: accept,
 			next:   rt,
 		}
-		if mediaType.Convert != nil && mediaType.Convert.Kind == "Table" {
+		if mediaType.Convert != nil && mediaType.Convert.Kind == "Table" && includeObject != "" {
 			ao.query = map[string]string{
-				"includeObject": "Object",
+				includeObjectParam: includeObject,
 			}
 		}
 		return &ao
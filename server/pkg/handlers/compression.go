@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// compressionThreshold is the response size from which responses are compressed, as in the Kubernetes API server.
+const compressionThreshold = 128 * 1024
+
+// CompressionMiddleware compresses list responses with gzip for clients that accept it, but never watches.
+func CompressionMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := mux.Vars(r)["resource"]; !ok || requestVerb(r) == "watch" || !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &compressWriter{ResponseWriter: w}
+			defer func() {
+				// leave an aborted response without the end of the gzip stream, so the client fails to read it
+				if err := recover(); err != nil {
+					panic(err)
+				}
+				cw.close()
+			}()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// acceptsGzip returns whether gzip is one of the encodings in the Accept-Encoding header.
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		encoding, _, _ = strings.Cut(encoding, ";")
+		if strings.TrimSpace(encoding) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter starts compressing once the response reaches the compression threshold or is flushed.
+type compressWriter struct {
+	http.ResponseWriter
+	code   int
+	buffer bytes.Buffer
+	gzip   *gzip.Writer
+	// started is set once the status and headers are written.
+	started bool
+}
+
+func (c *compressWriter) WriteHeader(code int) {
+	if !c.started && c.code == 0 {
+		c.code = code
+	}
+}
+
+func (c *compressWriter) Write(data []byte) (int, error) {
+	if c.started {
+		if c.gzip != nil {
+			return c.gzip.Write(data)
+		}
+		return c.ResponseWriter.Write(data)
+	}
+	n, _ := c.buffer.Write(data)
+	if c.buffer.Len() >= compressionThreshold {
+		if err := c.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Flush starts compressing a response that is written in parts, and sends what has been written so far.
+func (c *compressWriter) Flush() {
+	if !c.started {
+		if err := c.startGzip(); err != nil {
+			return
+		}
+	}
+	if c.gzip != nil {
+		c.gzip.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *compressWriter) startGzip() error {
+	c.started = true
+	header := c.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+	c.writeHeader()
+	c.gzip = gzip.NewWriter(c.ResponseWriter)
+	_, err := c.gzip.Write(c.buffer.Bytes())
+	c.buffer.Reset()
+	return err
+}
+
+func (c *compressWriter) writeHeader() {
+	if c.code != 0 {
+		c.ResponseWriter.WriteHeader(c.code)
+	}
+}
+
+// close writes a response that was never compressed, or finishes the compressed stream.
+func (c *compressWriter) close() {
+	if c.gzip != nil {
+		c.gzip.Close()
+		return
+	}
+	if !c.started {
+		c.started = true
+		c.writeHeader()
+		if c.buffer.Len() > 0 {
+			c.ResponseWriter.Write(c.buffer.Bytes())
+		}
+	}
+}
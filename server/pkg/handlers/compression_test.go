@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func compressionServer(handler http.HandlerFunc) *httptest.Server {
+	router := mux.NewRouter()
+	router.Use(CompressionMiddleware())
+	router.HandleFunc("/{resource}", handler)
+	return httptest.NewServer(router)
+}
+
+func getGzip(t *testing.T, url string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// setting the header ourselves stops the transport from decompressing the response
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return resp
+}
+
+func TestCompression(t *testing.T) {
+	small := []byte(`{"items":[]}`)
+	large := bytes.Repeat([]byte("a"), compressionThreshold+1)
+	tests := []struct {
+		name       string
+		body       []byte
+		path       string
+		compressed bool
+	}{
+		{
+			name: "small list",
+			body: small,
+			path: "/pods",
+		},
+		{
+			name:       "large list",
+			body:       large,
+			path:       "/pods",
+			compressed: true,
+		},
+		{
+			name: "watch",
+			body: large,
+			path: "/pods?watch=true",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := compressionServer(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(test.body)
+			})
+			defer server.Close()
+			resp := getGzip(t, server.URL+test.path)
+			defer resp.Body.Close()
+			var body io.Reader = resp.Body
+			if encoding := resp.Header.Get("Content-Encoding"); test.compressed != (encoding == "gzip") {
+				t.Fatalf("got Content-Encoding %q, compressed %v", encoding, test.compressed)
+			}
+			if test.compressed {
+				reader, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				body = reader
+			}
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(data, test.body) {
+				t.Errorf("got %d bytes, want %d", len(data), len(test.body))
+			}
+		})
+	}
+}
+
+func TestCompressionAborted(t *testing.T) {
+	server := compressionServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items":[`))
+		w.(http.Flusher).Flush()
+		w.Write(bytes.Repeat([]byte(`{},`), compressionThreshold))
+		panic(http.ErrAbortHandler)
+	})
+	defer server.Close()
+	resp := getGzip(t, server.URL+"/pods")
+	defer resp.Body.Close()
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "gzip" {
+		t.Fatalf("got Content-Encoding %q, want gzip", encoding)
+	}
+	reader, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, err := io.ReadAll(reader); err == nil {
+		t.Errorf("expected the truncated response to fail, got %d bytes", len(data))
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	consistentParam = "consistent"
+	// consistentListAttempts is how many resource versions a consistent list tries before giving up.
+	consistentListAttempts = 3
+)
+
+// consistentListNamespaces lists every namespace at the same resource version, and returns false if it could not.
+func consistentListNamespaces(ctx context.Context, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, sem *semaphore.Weighted, partial bool) (namespaceListResults, bool, error) {
+	for attempt := 0; attempt < consistentListAttempts; attempt++ {
+		resourceVersion := opts.ResourceVersion
+		if resourceVersion == "" {
+			var err error
+			resourceVersion, err = currentResourceVersion(ctx, client, namespaces)
+			if err != nil {
+				return namespaceListResults{}, false, err
+			}
+			if resourceVersion == "" {
+				// the user can't list the resource in any namespace, so there is nothing to keep consistent
+				fanOut, err := listNamespaces(ctx, client, namespaces, opts, sem, partial)
+				return fanOut, true, err
+			}
+		}
+		nsOpts := opts
+		nsOpts.ResourceVersion = resourceVersion
+		nsOpts.ResourceVersionMatch = metav1.ResourceVersionMatchExact
+		fanOut, err := listNamespaces(ctx, client, namespaces, nsOpts, sem, partial)
+		if err == nil {
+			err = expiredError(fanOut.errs)
+		}
+		if err == nil {
+			fanOut.resourceVersion, _ = strconv.Atoi(resourceVersion)
+			return fanOut, true, nil
+		}
+		if (!apierrors.IsResourceExpired(err) && !apierrors.IsGone(err)) || opts.ResourceVersion != "" {
+			return namespaceListResults{}, false, err
+		}
+		logrus.Debugf("resource version %s was compacted during a consistent list, retrying: %v", resourceVersion, err)
+	}
+	fanOut, err := listNamespaces(ctx, client, namespaces, opts, sem, partial)
+	return fanOut, false, err
+}
+
+// currentResourceVersion returns the current resource version, or empty if the user can't list the resource.
+func currentResourceVersion(ctx context.Context, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace) (string, error) {
+	list, err := client.List(ctx, metav1.ListOptions{Limit: 1})
+	if err == nil {
+		return list.GetResourceVersion(), nil
+	}
+	if !apierrors.IsForbidden(err) {
+		return "", err
+	}
+	for _, ns := range namespaces {
+		list, err := client.Namespace(ns.Name).List(ctx, metav1.ListOptions{Limit: 1})
+		if apierrors.IsForbidden(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return list.GetResourceVersion(), nil
+	}
+	return "", nil
+}
+
+// expiredError returns the error of a namespace that failed because the resource version was compacted, if any.
+func expiredError(errs *namespaceErrors) error {
+	errs.lock.Lock()
+	defer errs.lock.Unlock()
+	for _, nsErr := range errs.failed {
+		if apierrors.IsResourceExpired(nsErr.err) || apierrors.IsGone(nsErr.err) {
+			return nsErr.err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func consistentList(t *testing.T, client *fakeClient, query string) (*httptest.ResponseRecorder, testPage) {
+	t.Helper()
+	namespaces := testNamespaceCache(
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+	)
+	handler := NamespaceHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, namespaces, nil, nil)
+	w := httptest.NewRecorder()
+	handler(w, testRequest("/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets?consistent=true"+query, map[string]string{"namespace": "a", "resource": "secrets"}))
+	page := testPage{}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+		}
+	}
+	return w, page
+}
+
+// sortedCalls returns the calls ordered by namespace, keeping the order of the calls in each namespace.
+func sortedCalls(calls []fakeListCall) []fakeListCall {
+	sorted := append([]fakeListCall{}, calls...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].namespace < sorted[j].namespace
+	})
+	return sorted
+}
+
+func TestConsistentList(t *testing.T) {
+	client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s2"}}}
+	w, page := consistentList(t, client, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	if want := []string{"a/s1", "b/s2"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("got %v, want %v", page.names(), want)
+	}
+	if page.Metadata.ResourceVersion != "100" {
+		t.Errorf("got resource version %q, want 100", page.Metadata.ResourceVersion)
+	}
+	if warnings := w.Header().Values("Warning"); len(warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", warnings)
+	}
+	// the current resource version is read first, and every namespace is listed at exactly that version
+	exact := metav1.ListOptions{ResourceVersion: "100", ResourceVersionMatch: metav1.ResourceVersionMatchExact}
+	wantCalls := []fakeListCall{
+		{namespace: "", opts: metav1.ListOptions{Limit: 1}},
+		{namespace: "a", opts: exact},
+		{namespace: "b", opts: exact},
+	}
+	if got := sortedCalls(client.calls); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("got calls %+v, want %+v", got, wantCalls)
+	}
+}
+
+func TestConsistentListCompacted(t *testing.T) {
+	client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s2"}}, expired: true}
+	w, page := consistentList(t, client, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	// after the retries, the namespaces are listed at their latest resource version
+	if want := []string{"a/s1", "b/s2"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("got %v, want %v", page.names(), want)
+	}
+	warnings := w.Header().Values("Warning")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "not a consistent snapshot") {
+		t.Errorf("expected a warning that the list is not consistent, got %v", warnings)
+	}
+	resourceVersionReads := 0
+	for _, call := range client.calls {
+		if call.namespace == "" {
+			resourceVersionReads++
+		}
+	}
+	if resourceVersionReads != consistentListAttempts {
+		t.Errorf("got %d reads of the current resource version, want %d", resourceVersionReads, consistentListAttempts)
+	}
+}
+
+func TestConsistentListCompactedResourceVersion(t *testing.T) {
+	// a resource version the client asked for is never replaced by another one
+	client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s2"}}, expired: true}
+	w, _ := consistentList(t, client, "&resourceVersion=50")
+	if w.Code != http.StatusGone {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusGone)
+	}
+	for _, call := range client.calls {
+		if call.opts.ResourceVersion != "50" {
+			t.Errorf("got a list at resource version %q in %q, want only 50", call.opts.ResourceVersion, call.namespace)
+		}
+	}
+}
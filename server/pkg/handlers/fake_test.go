@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/gorilla/mux"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/dynamic"
+	corecache "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var secretsResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// fakeClient lists the objects in each namespace by name, honoring the limit and continue options and a field
+// selector on the name, and records the options of every list. Like the Kubernetes API server, it rejects a continue
+// token together with a resource version, and never reports the remaining item count. A list without a namespace lists every namespace.
+// If a namespace has columns, it returns a Table with a row for each object instead.
+type fakeClient struct {
+	dynamic.NamespaceableResourceInterface
+	objects   map[string][]string
+	columns   map[string][]string
+	forbidden map[string]bool
+	// data is the data of the objects, by namespace/name.
+	data map[string]map[string]interface{}
+	// expired makes every list at an exact resource version fail as if the resource version was compacted.
+	expired bool
+
+	lock  sync.Mutex
+	calls []fakeListCall
+}
+
+type fakeListCall struct {
+	namespace string
+	opts      metav1.ListOptions
+}
+
+type fakeNamespaceClient struct {
+	dynamic.ResourceInterface
+	client    *fakeClient
+	namespace string
+}
+
+func (f *fakeClient) Namespace(ns string) dynamic.ResourceInterface {
+	return &fakeNamespaceClient{client: f, namespace: ns}
+}
+
+func (f *fakeClient) List(ctx context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	return f.Namespace("").List(ctx, opts)
+}
+
+func (f *fakeNamespaceClient) List(_ context.Context, opts metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	f.client.lock.Lock()
+	f.client.calls = append(f.client.calls, fakeListCall{namespace: f.namespace, opts: opts})
+	f.client.lock.Unlock()
+	if f.client.forbidden[f.namespace] {
+		return nil, apierrors.NewForbidden(secretsResource.GroupResource(), "", fmt.Errorf("not allowed in %s", f.namespace))
+	}
+	if opts.Continue != "" && (opts.ResourceVersion != "" || opts.ResourceVersionMatch != "") {
+		return nil, apierrors.NewBadRequest("specifying resource version is not allowed when using continue")
+	}
+	if f.client.expired && opts.ResourceVersionMatch == metav1.ResourceVersionMatchExact {
+		return nil, apierrors.NewResourceExpired("too old resource version")
+	}
+	selector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	type object struct{ namespace, name string }
+	objects := make([]object, 0)
+	namespaces := []string{f.namespace}
+	if f.namespace == "" {
+		namespaces = make([]string, 0, len(f.client.objects))
+		for ns := range f.client.objects {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+	}
+	for _, ns := range namespaces {
+		for _, name := range f.client.objects[ns] {
+			if selector.Matches(fields.Set{"metadata.name": name}) {
+				objects = append(objects, object{namespace: ns, name: name})
+			}
+		}
+	}
+	start := 0
+	if opts.Continue != "" {
+		start, _ = strconv.Atoi(opts.Continue)
+	}
+	end := len(objects)
+	if opts.Limit > 0 && start+int(opts.Limit) < end {
+		end = start + int(opts.Limit)
+	}
+	list := &unstructured.UnstructuredList{}
+	list.SetResourceVersion("100")
+	for _, o := range objects[start:end] {
+		obj := unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Secret")
+		obj.SetNamespace(o.namespace)
+		obj.SetName(o.name)
+		if data, ok := f.client.data[o.namespace+"/"+o.name]; ok {
+			obj.Object["data"] = data
+		}
+		list.Items = append(list.Items, obj)
+	}
+	if end < len(objects) {
+		list.SetContinue(strconv.Itoa(end))
+	}
+	if columns, ok := f.client.columns[f.namespace]; ok {
+		return fakeTable(list, columns), nil
+	}
+	return list, nil
+}
+
+type fakeAPIs struct {
+	apiresources.APIResourceWatcher
+}
+
+// GetKindForResource returns Widget for widgets, and Secret for any other resource.
+func (fakeAPIs) GetKindForResource(resource schema.GroupVersionResource) string {
+	if resource.Resource == "widgets" {
+		return "Widget"
+	}
+	return "Secret"
+}
+
+// Get knows secrets and configmaps in the core group.
+func (fakeAPIs) Get(resource, group string) (metav1.APIResource, bool) {
+	if group != "" || (resource != "secrets" && resource != "configmaps") {
+		return metav1.APIResource{}, false
+	}
+	return metav1.APIResource{Name: resource, Version: "v1", Namespaced: true}, true
+}
+
+// GetCategory puts secrets and configmaps in the all category.
+func (fakeAPIs) GetCategory(category string) []metav1.APIResource {
+	if category != "all" {
+		return nil
+	}
+	return []metav1.APIResource{{Name: "secrets", Version: "v1"}, {Name: "configmaps", Version: "v1"}}
+}
+
+// fakeAuthorizer allows the verbs in allowed, by namespace/group/resource/verb, and records the key of every
+// decision.
+type fakeAuthorizer struct {
+	allowed map[string]bool
+
+	lock  sync.Mutex
+	calls []string
+}
+
+func (f *fakeAuthorizer) Authorize(_ context.Context, _ user.Info, attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+	key := attributes.Namespace + "/" + attributes.Group + "/" + attributes.Resource + "/" + attributes.Verb
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls = append(f.calls, key)
+	return f.allowed[key], "not allowed", nil
+}
+
+func testNamespaces(names ...string) []*corev1.Namespace {
+	namespaces := make([]*corev1.Namespace, 0, len(names))
+	for _, name := range names {
+		namespaces = append(namespaces, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	return namespaces
+}
+
+// testNamespaceCache returns a namespace lister that holds the namespaces.
+func testNamespaceCache(namespaces ...*corev1.Namespace) corecache.NamespaceLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, ns := range namespaces {
+		indexer.Add(ns)
+	}
+	return corecache.NewNamespaceLister(indexer)
+}
+
+// testClientGetter returns the client for the resource, or the client for secrets if there is none.
+func testClientGetter(clients map[schema.GroupVersionResource]*fakeClient) clientGetter {
+	return func(_ *http.Request, resource schema.GroupVersionResource) (dynamic.NamespaceableResourceInterface, error) {
+		if client, ok := clients[resource]; ok {
+			return client, nil
+		}
+		return clients[secretsResource], nil
+	}
+}
+
+// testRequest returns a request for the path made by a user, with the given route variables.
+func testRequest(path string, vars map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r = r.WithContext(request.WithUser(r.Context(), &user.DefaultInfo{Name: "alice"}))
+	return mux.SetURLVars(r, vars)
+}
+
+// fakeTable turns a list into a Table with the given columns, where every cell holds the column name.
+func fakeTable(list *unstructured.UnstructuredList, columns []string) *unstructured.UnstructuredList {
+	columnDefinitions := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		columnDefinitions = append(columnDefinitions, map[string]interface{}{"name": column, "type": "string"})
+	}
+	rows := make([]interface{}, 0, len(list.Items))
+	for _, item := range list.Items {
+		cells := make([]interface{}, 0, len(columns))
+		for _, column := range columns {
+			cells = append(cells, column)
+		}
+		rows = append(rows, map[string]interface{}{"cells": cells, "object": item.Object})
+	}
+	table := &unstructured.UnstructuredList{Object: map[string]interface{}{
+		"columnDefinitions": columnDefinitions,
+		"rows":              rows,
+	}}
+	table.SetAPIVersion("meta.k8s.io/v1")
+	table.SetKind("Table")
+	table.SetResourceVersion(list.GetResourceVersion())
+	table.SetContinue(list.GetContinue())
+	return table
+}
@@ -3,16 +3,21 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"golang.org/x/sync/semaphore"
 	"net/http"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/cmurphy/hns-list/pkg/audit"
 	"github.com/cmurphy/hns-list/pkg/consts"
+	"github.com/cmurphy/hns-list/pkg/policy"
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"github.com/cmurphy/hns-list/pkg/redaction"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
@@ -20,6 +25,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -34,10 +40,27 @@ const (
 	ExtensionConfigMap  = "extension-apiserver-authentication"
 	ClientCAKey         = "requestheader-client-ca-file"
 	AllowedCNKey        = "requestheader-allowed-names"
-	workers             = int64(3)
+	UsernameHeadersKey  = "requestheader-username-headers"
+	GroupHeadersKey     = "requestheader-group-headers"
+	ExtraHeadersKey     = "requestheader-extra-headers-prefix"
 	hnsLabelSuffix      = ".tree.hnc.x-k8s.io/depth"
+	// skippedNamespacesKey is the list metadata field that holds the namespaces the user is not allowed to read.
+	skippedNamespacesKey = "skippedNamespaces"
+	// warningCode is the miscellaneous persistent warning code used by the Kubernetes API server.
+	warningCode = 299
+	// bookmarkInterval is how often an idle watch sends a bookmark, if the client allows them.
+	bookmarkInterval = time.Minute
 )
 
+// errWatchClosed ends a watch stream when one of the watches in it ends or fails.
+var errWatchClosed = errors.New("watch closed")
+
+// namespaceError records an error returned by a request for a single namespace.
+type namespaceError struct {
+	namespace string
+	err       error
+}
+
 var (
 	paramScheme = runtime.NewScheme()
 	paramCodec  = runtime.NewParameterCodec(paramScheme)
@@ -47,49 +70,6 @@ func init() {
 	metav1.AddToGroupVersion(paramScheme, metav1.SchemeGroupVersion)
 }
 
-func AuthenticateMiddleware(configMapCache corecache.ConfigMapNamespaceLister) mux.MiddlewareFunc {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if len(r.TLS.PeerCertificates) == 0 {
-				logrus.Warnf("user is not authenticated")
-				http.Error(w, "user is not authenticated", http.StatusUnauthorized)
-				return
-			}
-			requestCN := r.TLS.PeerCertificates[0].Subject.CommonName
-			logrus.Tracef("authenticating user %s", requestCN)
-			config, err := configMapCache.Get(ExtensionConfigMap)
-			if err != nil {
-				logrus.Errorf("could not authenticate API server, err: %v", err)
-				http.Error(w, fmt.Sprintf("could not authenticate API server, error: %v", err), http.StatusInternalServerError)
-				return
-			}
-			allowedCNString, ok := config.Data[AllowedCNKey]
-			if !ok {
-				http.Error(w, "could not authenticate API server, invalid extension config", http.StatusInternalServerError)
-			}
-			allowedCN := []string{}
-			if err := json.Unmarshal([]byte(allowedCNString), &allowedCN); err != nil {
-				logrus.Errorf("could not authenticate API server, err: %v", err)
-				http.Error(w, fmt.Sprintf("could not authenticate API server, error: %v", err), http.StatusInternalServerError)
-				return
-			}
-			found := false
-			for _, allowed := range allowedCN {
-				if allowed == requestCN {
-					found = true
-					break
-				}
-			}
-			if !found {
-				logrus.Warnf("could not find user %s in allowed users", requestCN)
-				http.Error(w, fmt.Sprintf("user %s not allowed", requestCN), http.StatusUnauthorized)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
-}
-
 func DiscoveryHandler(apis apiresources.APIResourceWatcher) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		logrus.Tracef("handling request %s\n", req.URL.Path)
@@ -109,7 +89,8 @@ func DiscoveryHandler(apis apiresources.APIResourceWatcher) http.HandlerFunc {
 	}
 }
 
-func Forwarder(clientGetter clientGetter, apis apiresources.APIResourceWatcher) http.HandlerFunc {
+// Forwarder lists or watches a resource across all namespaces.
+func Forwarder(clientGetter clientGetter, apis apiresources.APIResourceWatcher, namespaceCache corecache.NamespaceLister, exclusions *policy.NamespaceExclusions, redactor *redaction.Redactor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logrus.Tracef("handling request %s\n", r.URL.Path)
 		vars := mux.Vars(r)
@@ -120,90 +101,164 @@ func Forwarder(clientGetter clientGetter, apis apiresources.APIResourceWatcher)
 		}
 		resourceClient, err := clientGetter(r, resource)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), clientErrorStatus(err))
 			return
 		}
 		opts := metav1.ListOptions{}
 		paramCodec.DecodeParameters(r.URL.Query(), metav1.SchemeGroupVersion, &opts)
 
+		if !exclusions.Empty() || r.URL.Query().Has(namespaceSelectorParam) || r.URL.Query().Has(summaryParam) {
+			selector, err := namespaceSelector(r.URL.Query())
+			if isErrorAndHandleError(w, err) {
+				return
+			}
+			namespaces, err := namespaceCache.List(selector)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			namespacesHandler(w, r, resource, resourceClient, exclusions.Filter(namespaces), opts, apis, redactor)
+			return
+		}
+
+		// a single cluster-wide request covers every namespace
+		if namespaces, err := namespaceCache.List(labels.Everything()); err == nil {
+			audit.SetNamespacesQueried(r.Context(), len(namespaces))
+		}
 		if opts.Watch {
-			watcher, err := getWatchers(r.Context(), resourceClient, nil, opts)
+			watcher, err := resourceClient.Watch(r.Context(), opts)
 			if isErrorAndHandleError(w, err) {
 				return
 			}
-			watchHandler(w, r, resourceClient, watcher, opts)
+			watchHandler(w, r, resource, apis, []watch.Interface{watcher}, redactor, cachedHierarchies(r, namespaceCache))
+			return
+		}
+		less, err := sorter(r.URL.Query().Get(sortByParam), cachedTreePaths(namespaceCache))
+		if isErrorAndHandleError(w, err) {
 			return
 		}
 		resources, err := resourceClient.List(r.Context(), opts)
 		if isErrorAndHandleError(w, err) {
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		returnResp(w, resources.UnstructuredContent())
+		rows, _ := resources.Object["rows"].([]interface{})
+		// redacted fields must not influence the order
+		for i := range resources.Items {
+			redactor.Redact(r.Context(), resource, resources.Items[i].Object)
+		}
+		redactor.RedactRows(r.Context(), resource, rows)
+		if r.URL.Query().Get(sortByParam) != "" {
+			sortItems(resources.Items, less)
+			sortRows(rows, less)
+		}
+		if columns, ok := resources.Object["columnDefinitions"].([]interface{}); ok {
+			resources.Object["columnDefinitions"] = addHierarchy(cachedHierarchies(r, namespaceCache), columns, nil, rows)
+		} else {
+			addHierarchy(cachedHierarchies(r, namespaceCache), nil, resources.Items, nil)
+		}
+		stripRowObjects(r, rows)
+		audit.AddItemsReturned(r.Context(), len(resources.Items)+len(rows))
+		if resources.GetKind() == "Table" {
+			w.Header().Set("Content-Type", "application/json")
+			returnResp(w, resources.UnstructuredContent())
+			return
+		}
+		writeObject(w, r, resource, apis, resources)
 	}
 }
 
-func NamespaceHandler(clientGetter clientGetter, apis apiresources.APIResourceWatcher, namespaceCache corecache.NamespaceLister) http.HandlerFunc {
+// NamespaceHandler lists or watches a resource in the subtrees of one or more namespaces.
+func NamespaceHandler(clientGetter clientGetter, apis apiresources.APIResourceWatcher, namespaceCache corecache.NamespaceLister, exclusions *policy.NamespaceExclusions, redactor *redaction.Redactor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		logrus.Tracef("handling request %s\n", r.URL.Path)
 
 		vars := mux.Vars(r)
-		namespace := vars["namespace"]
-		resource, err := gvrFromVars(vars, apis)
+		resources, err := gvrsFromVars(vars, apis)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusNotFound)
 			return
 		}
-		resourceClient, err := clientGetter(r, resource)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
 
 		opts := metav1.ListOptions{}
 		paramCodec.DecodeParameters(r.URL.Query(), metav1.SchemeGroupVersion, &opts)
+		if name, ok := vars["name"]; ok {
+			opts.FieldSelector, err = nameFieldSelector(opts.FieldSelector, name)
+			if isErrorAndHandleError(w, err) {
+				return
+			}
+		}
 
-		label := namespace + hnsLabelSuffix
-		selector, err := labels.Parse(label)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		namespaces, err := subtreeNamespaces(namespaceCache, subtreeRoots(r), r.URL.Query())
+		if isErrorAndHandleError(w, err) {
 			return
 		}
-		namespaces, err := namespaceCache.List(selector)
+		namespaces = exclusions.Filter(namespaces)
+		if len(resources) > 1 {
+			multiResourceHandler(w, r, clientGetter, resources, namespaces, opts, redactor)
+			return
+		}
+		resourceClient, err := clientGetter(r, resources[0])
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), clientErrorStatus(err))
 			return
 		}
+		namespacesHandler(w, r, resources[0], resourceClient, namespaces, opts, apis, redactor)
+	}
+}
 
-		if opts.Watch {
-			watchers, err := getWatchers(r.Context(), resourceClient, namespaces, opts)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusNotFound)
-				return
-			}
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			watchHandler(w, r, resourceClient, watchers, opts)
+// namespacesHandler lists or watches a resource in each of the given namespaces.
+func namespacesHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, apis apiresources.APIResourceWatcher, redactor *redaction.Redactor) {
+	if opts.Watch && r.URL.Query().Has(summaryParam) {
+		isErrorAndHandleError(w, apierrors.NewBadRequest("summaries can not be watched"))
+		return
+	}
+	var less objectLess
+	if !opts.Watch {
+		var err error
+		less, err = sorter(r.URL.Query().Get(sortByParam), namespaceTreePaths(namespaces))
+		if isErrorAndHandleError(w, err) {
 			return
 		}
-		listHandler(w, r, resource, resourceClient, namespaces, opts, apis)
+	}
+	if !opts.Watch && r.URL.Query().Has(summaryParam) {
+		summaryHandler(w, r, resource, client, namespaces, opts)
 		return
 	}
-}
-
-func getWatchers(ctx context.Context, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions) ([]watch.Interface, error) {
-	if len(namespaces) == 0 {
-		watcher, err := client.Watch(ctx, opts)
-		if err != nil {
-			return nil, err
+	if !opts.Watch && opts.Limit > 0 {
+		paginatedListHandler(w, r, resource, client, namespaces, opts, apis, redactor, less)
+		return
+	}
+	audit.SetNamespacesQueried(r.Context(), len(namespaces))
+	if isErrorAndHandleError(w, ratelimit.ReserveNamespaces(r.Context(), len(namespaces))) {
+		return
+	}
+	if opts.Watch {
+		watchers, errs, err := getWatchers(r.Context(), client, namespaces, opts, partialResults(r))
+		if isErrorAndHandleError(w, err) {
+			return
 		}
-		return []watch.Interface{watcher}, nil
+		errs.addWarnings(w)
+		if len(watchers) == 0 {
+			idleWatchHandler(w, r, resource, client, opts, apis)
+			return
+		}
+		watchHandler(w, r, resource, apis, watchers, redactor, namespaceHierarchies(r, namespaces))
+		return
 	}
+	// streamed lists are only written as JSON
+	if stream, _ := strconv.ParseBool(r.URL.Query().Get(streamParam)); stream && !outputProtobuf(r, resource, apis) {
+		streamListHandler(w, r, resource, client, namespaces, opts, apis, redactor, less)
+		return
+	}
+	listHandler(w, r, resource, client, namespaces, opts, apis, redactor, less)
+}
+
+// getWatchers starts a watch for each namespace.
+func getWatchers(ctx context.Context, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, partial bool) ([]watch.Interface, *namespaceErrors, error) {
 	watcherChan := make(chan watch.Interface)
 	done := make(chan bool)
 	watchers := make([]watch.Interface, 0)
+	errs := newNamespaceErrors(partial)
 	go func() {
 		for watcher := range watcherChan {
 			watchers = append(watchers, watcher)
@@ -216,30 +271,51 @@ func getWatchers(ctx context.Context, client dynamic.NamespaceableResourceInterf
 		eg.Go(func() error {
 			watcher, err := client.Namespace(ns).Watch(ctx, opts)
 			if err != nil {
-				return err
+				return errs.add(ns, err)
 			}
 			watcherChan <- watcher
 			return nil
 		})
 	}
 	err := eg.Wait()
-	if err != nil {
-		return nil, err
-	}
 	close(watcherChan)
 	<-done
-	return watchers, nil
+	if err == nil && len(watchers) == 0 {
+		err = errs.err(len(namespaces))
+	}
+	if err != nil {
+		stopWatchers(watchers)
+		return nil, nil, err
+	}
+	return watchers, errs, nil
 }
 
-func watchHandler(w http.ResponseWriter, r *http.Request, client dynamic.NamespaceableResourceInterface, watchers []watch.Interface, opts metav1.ListOptions) {
-	events := make(chan metav1.WatchEvent)
+func stopWatchers(watchers []watch.Interface) {
+	for _, watcher := range watchers {
+		watcher.Stop()
+	}
+}
+
+// watchHandler streams the events of all the watchers until the client goes away or one of them ends.
+func watchHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, apis apiresources.APIResourceWatcher, watchers []watch.Interface, redactor *redaction.Redactor, hierarchy hierarchyLookup) {
+	events := make(chan watch.Event)
 	doneEvents := make(chan bool)
 
+	contentType := "application/json"
+	var encode watchEncoder = jsonWatchEncoder
+	if outputProtobuf(r, resource, apis) {
+		contentType = protobufWatchContentType
+		encode = protobufWatchEncoder(w)
+	}
 	go func() {
-		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Type", contentType)
 		for event := range events {
-			returnResp(w, event)
+			if err := encode(w, event); err != nil {
+				logrus.Errorf("could not encode watch event: %v", err)
+				continue
+			}
 			w.(http.Flusher).Flush()
+			audit.AddItemsReturned(r.Context(), 1)
 		}
 		doneEvents <- true
 	}()
@@ -250,12 +326,19 @@ func watchHandler(w http.ResponseWriter, r *http.Request, client dynamic.Namespa
 		eg.Go(func() error {
 			for {
 				select {
-				case event := <-watcher.ResultChan():
-					outEvent, err := convertEvent(event)
-					if err != nil {
-						return err
+				case event, ok := <-watcher.ResultChan():
+					if !ok {
+						return errWatchClosed
 					}
-					events <- *outEvent
+					if event.Type == watch.Error {
+						logrus.Debugf("watch failed: %v", apierrors.FromObject(event.Object))
+						events <- event
+						return errWatchClosed
+					}
+					redactEvent(r.Context(), redactor, resource, event)
+					addEventHierarchy(hierarchy, event)
+					stripEventRowObjects(r, event)
+					events <- event
 				case <-ctx.Done():
 					return nil
 				}
@@ -263,161 +346,259 @@ func watchHandler(w http.ResponseWriter, r *http.Request, client dynamic.Namespa
 		})
 	}
 	err := eg.Wait()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	close(events)
+	<-doneEvents
+	stopWatchers(watchers)
+	if err != nil && !errors.Is(err, errWatchClosed) {
+		logrus.Errorf("watch failed: %v", err)
 	}
-	if ctx.Err() == context.Canceled {
+	if r.Context().Err() == context.Canceled {
 		logrus.Debugf("client disconnected: %v", r.RemoteAddr)
 	}
-	<-doneEvents
-	return
 }
 
-func listHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, apis apiresources.APIResourceWatcher) {
-	itemsChan := make(chan unstructured.Unstructured)
-	rowsChan := make(chan interface{})
-	itemsList := make([]unstructured.Unstructured, 0)
-	rowList := make([]interface{}, 0)
-	latestResourceVersion := 0
-	resourceVersions := make(chan int)
-	var columns []interface{}
+// idleWatchHandler holds a watch with no namespaces open until the client goes away or the timeout passes.
+func idleWatchHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, opts metav1.ListOptions, apis apiresources.APIResourceWatcher) {
+	ctx := r.Context()
+	if opts.TimeoutSeconds != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(*opts.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+	contentType := "application/json"
+	var encode watchEncoder = jsonWatchEncoder
+	if outputProtobuf(r, resource, apis) {
+		contentType = protobufWatchContentType
+		encode = protobufWatchEncoder(w)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
 
-	wg := sync.WaitGroup{}
-	wg.Add(3)
+	var bookmark *unstructured.Unstructured
+	if opts.AllowWatchBookmarks {
+		bookmark = bookmarkObject(r, resource, client, opts, apis)
+	}
+	var tick <-chan time.Time
+	if bookmark != nil {
+		ticker := time.NewTicker(bookmarkInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			if err := encode(w, watch.Event{Type: watch.Bookmark, Object: bookmark}); err != nil {
+				logrus.Errorf("could not encode watch event: %v", err)
+				return
+			}
+			w.(http.Flusher).Flush()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-	go func() {
-		for i := range itemsChan {
-			itemsList = append(itemsList, i)
+// bookmarkObject returns the object for bookmark events of an idle watch, or nil if no resource version is known.
+func bookmarkObject(r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, opts metav1.ListOptions, apis apiresources.APIResourceWatcher) *unstructured.Unstructured {
+	resourceVersion := opts.ResourceVersion
+	if resourceVersion == "" || resourceVersion == "0" {
+		var err error
+		resourceVersion, err = emptyResourceVersion(r.Context(), resource, client)
+		if err != nil {
+			logrus.Debugf("not sending bookmarks: %v", err)
+			return nil
 		}
-		wg.Done()
-	}()
+	}
+	bookmark := &unstructured.Unstructured{}
+	if mediaType, ok := negotiate(r, protobufSupported(resource, apis)); ok && mediaType.Convert != nil && mediaType.Convert.Kind == "Table" {
+		bookmark.SetAPIVersion(metav1.SchemeGroupVersion.String())
+		bookmark.SetKind("Table")
+	} else {
+		bookmark.SetAPIVersion(resource.GroupVersion().String())
+		bookmark.SetKind(apis.GetKindForResource(resource))
+	}
+	bookmark.SetResourceVersion(resourceVersion)
+	return bookmark
+}
+
+func listHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, apis apiresources.APIResourceWatcher, redactor *redaction.Redactor, less objectLess) {
+	var fanOut namespaceListResults
+	var err error
+	sem := semaphore.NewWeighted(ratelimit.NamespaceWorkers(r.Context()))
+	if consistent, _ := strconv.ParseBool(r.URL.Query().Get(consistentParam)); consistent {
+		var snapshot bool
+		fanOut, snapshot, err = consistentListNamespaces(r.Context(), client, namespaces, opts, sem, partialResults(r))
+		if err == nil && !snapshot {
+			addWarning(w, "could not list every namespace at the same resource version, the list is not a consistent snapshot")
+		}
+	} else {
+		fanOut, err = listNamespaces(r.Context(), client, namespaces, opts, sem, partialResults(r))
+	}
+	if err == nil {
+		err = fanOut.errs.err(len(namespaces))
+	}
+	if isErrorAndHandleError(w, err) {
+		return
+	}
+	fanOut.errs.addWarnings(w)
+
+	columns, itemsList, rowList := mergeLists(fanOut.results)
+	for i := range itemsList {
+		redactor.Redact(r.Context(), resource, itemsList[i].Object)
+	}
+	redactor.RedactRows(r.Context(), resource, rowList)
+	sortItems(itemsList, less)
+	sortRows(rowList, less)
+	columns = addHierarchy(namespaceHierarchies(r, namespaces), columns, itemsList, rowList)
+
+	resourceVersion := strconv.Itoa(fanOut.resourceVersion)
+	if resourceVersion == "0" { // this may happen if the namespace slice was empty, but we still need to return a valid resource version.
+		resourceVersion, err = emptyResourceVersion(r.Context(), resource, client)
+		if apierrors.IsForbidden(err) {
+			// users who can't list cluster-wide still get an empty list, and can watch from any resource version
+			resourceVersion, err = "0", nil
+		}
+		if isErrorAndHandleError(w, err) {
+			return
+		}
+	}
+	writeList(w, r, resource, apis, listMeta(resourceVersion, "", fanOut.errs), columns, itemsList, rowList)
+}
+
+// namespaceListResults are the lists returned by the namespaces of a fan-out.
+type namespaceListResults struct {
+	results []namespaceList
+	// resourceVersion is the latest resource version returned by any namespace.
+	resourceVersion int
+	// errs are the namespaces that were left out.
+	errs *namespaceErrors
+}
+
+// listNamespaces lists the resource in each of the namespaces, as many at a time as the semaphore allows.
+func listNamespaces(ctx context.Context, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, sem *semaphore.Weighted, partial bool) (namespaceListResults, error) {
+	resultsChan := make(chan namespaceList)
+	resourceVersions := make(chan int)
+	fanOut := namespaceListResults{
+		results: make([]namespaceList, 0, len(namespaces)),
+		errs:    newNamespaceErrors(partial),
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
 
 	go func() {
-		for r := range rowsChan {
-			rowList = append(rowList, r)
+		for result := range resultsChan {
+			fanOut.results = append(fanOut.results, result)
 		}
 		wg.Done()
 	}()
 
 	go func() {
 		for r := range resourceVersions {
-			if r > latestResourceVersion {
-				latestResourceVersion = r
+			if r > fanOut.resourceVersion {
+				fanOut.resourceVersion = r
 			}
 		}
 		wg.Done()
 	}()
 
-	eg, ctx := errgroup.WithContext(r.Context())
-	sem := semaphore.NewWeighted(workers)
+	eg, ctx := errgroup.WithContext(ctx)
 	for _, ns := range namespaces {
 		ns := ns.Name
 		if err := sem.Acquire(ctx, 1); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			// the context is only done if a list failed or the client went away, which Wait reports below
+			eg.Go(func() error { return err })
+			break
 		}
 		eg.Go(func() error {
 			defer sem.Release(1)
 			resourcesForNamespace, err := client.Namespace(ns).List(ctx, opts)
 			if err != nil {
-				return err
+				return fanOut.errs.add(ns, err)
 			}
 			if resourcesForNamespace == nil {
 				return nil
 			}
-			rows, _ := resourcesForNamespace.Object["rows"].([]interface{})
-			columns, _ = resourcesForNamespace.Object["columnDefinitions"].([]interface{})
-			if len(resourcesForNamespace.Items) > 0 || (len(rows) > 0) {
-				// resourceVersion will be different for every request, and in the end we want the latest one,
-				// but we won't know which one is the latest until the channel is done processing.
-				rv, err := strconv.Atoi(resourcesForNamespace.GetResourceVersion())
-				if err != nil {
-					rv = 0
-				}
-				resourceVersions <- rv
-			}
-			for _, r := range rows {
-				rowsChan <- r
-			}
-			for _, r := range resourcesForNamespace.Items {
-				itemsChan <- r
+			// resourceVersion will be different for every request, and in the end we want the latest one,
+			// but we won't know which one is the latest until the channel is done processing.
+			rv, err := strconv.Atoi(resourcesForNamespace.GetResourceVersion())
+			if err != nil {
+				rv = 0
 			}
+			resourceVersions <- rv
+			resultsChan <- namespaceList{namespace: ns, list: resourcesForNamespace}
 			return nil
 		})
 	}
 	err := eg.Wait()
-	if isErrorAndHandleError(w, err) {
-		return
-	}
-	close(itemsChan)
-	close(rowsChan)
+	close(resultsChan)
 	close(resourceVersions)
 	wg.Wait()
-
-	sortItems(itemsList)
-	sortRows(rowList)
-
-	resourceVersion := strconv.Itoa(latestResourceVersion)
-	if resourceVersion == "0" { // this may happen if the namespace slice was empty, but we still need to return a valid resource version.
-		resourceVersion, err = emptyResourceVersion(r.Context(), resource, client)
-		if isErrorAndHandleError(w, err) {
-			return
-		}
+	if err != nil {
+		return namespaceListResults{}, err
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if len(rowList) > 0 {
-		resp := responseTable(resourceVersion, columns, rowList)
+	return fanOut, nil
+}
+
+// writeList writes the merged items, or the merged rows if the namespaces returned Tables.
+func writeList(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, apis apiresources.APIResourceWatcher, meta map[string]interface{}, columns []interface{}, items []unstructured.Unstructured, rows []interface{}) {
+	audit.AddItemsReturned(r.Context(), len(items)+len(rows))
+	if columns != nil {
+		stripRowObjects(r, rows)
+		resp := responseTable(meta, columns, rows)
+		w.Header().Set("Content-Type", "application/json")
 		returnResp(w, resp)
 		return
 	}
-	resp := responseData(resource, apis.GetKindForResource(resource)+"List", resourceVersion, itemsList)
-	returnResp(w, resp)
+	resp := responseData(resource, apis.GetKindForResource(resource)+"List", meta, items)
+	writeObject(w, r, resource, apis, resp)
 }
 
-func sortItems(resourceCollection []unstructured.Unstructured) {
-	sort.Slice(resourceCollection, func(i, j int) bool {
-		objI := resourceCollection[i]
-		objJ := resourceCollection[j]
-		if objI.GetNamespace() < objJ.GetNamespace() {
-			return true
-		}
-		if objI.GetNamespace() > objJ.GetNamespace() {
-			return false
-		}
-		return objI.GetName() < objJ.GetName()
-	})
+// nameFieldSelector adds a requirement for the object name to the field selector.
+func nameFieldSelector(fieldSelector, name string) (string, error) {
+	selector, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return "", apierrors.NewBadRequest(fmt.Sprintf("invalid field selector: %v", err))
+	}
+	nameSelector := fields.OneTermEqualSelector("metadata.name", name)
+	if selector.Empty() {
+		return nameSelector.String(), nil
+	}
+	return fields.AndSelectors(selector, nameSelector).String(), nil
 }
 
-func sortRows(rows []interface{}) {
-	sort.Slice(rows, func(i, j int) bool {
-		rowI, _ := rows[i].(map[string]interface{})
-		objI, _ := rowI["object"].(map[string]interface{})
-		unstI := unstructured.Unstructured{Object: objI}
-		rowJ, _ := rows[j].(map[string]interface{})
-		objJ, _ := rowJ["object"].(map[string]interface{})
-		unstJ := unstructured.Unstructured{Object: objJ}
-		if unstI.GetNamespace() < unstJ.GetNamespace() {
-			return true
-		}
-		if unstI.GetNamespace() > unstJ.GetNamespace() {
-			return false
-		}
-		return unstI.GetName() < unstJ.GetName()
-	})
+func gvrFromVars(vars map[string]string, apis apiresources.APIResourceWatcher) (schema.GroupVersionResource, error) {
+	resourceName, group := splitResourceName(vars["resource"])
+	resource, ok := apis.Get(resourceName, group)
+	if !ok {
+		return schema.GroupVersionResource{}, fmt.Errorf("could not find resource %s", vars["resource"])
+	}
+	return schema.GroupVersionResource{Group: group, Version: resource.Version, Resource: resourceName}, nil
 }
 
-func gvrFromVars(vars map[string]string, apis apiresources.APIResourceWatcher) (schema.GroupVersionResource, error) {
-	groupResource := strings.Split(vars["resource"], ".")
+// splitResourceName splits a resource name of the form group.resource into the resource and the group.
+func splitResourceName(name string) (string, string) {
+	groupResource := strings.Split(name, ".")
 	group := ""
 	if len(groupResource) > 1 {
 		group = strings.Join(groupResource[:len(groupResource)-1], ".")
 	}
-	resourceName := groupResource[len(groupResource)-1]
-	resource, ok := apis.Get(resourceName, group)
+	return groupResource[len(groupResource)-1], group
+}
+
+// redactEvent redacts the object in a watch event, which is either a single object or a Table of rows.
+func redactEvent(ctx context.Context, redactor *redaction.Redactor, resource schema.GroupVersionResource, event watch.Event) {
+	obj, ok := event.Object.(*unstructured.Unstructured)
 	if !ok {
-		return schema.GroupVersionResource{}, fmt.Errorf("could not find resource %s", vars["resource"])
+		return
 	}
-	return schema.GroupVersionResource{Group: group, Version: resource.Version, Resource: resourceName}, nil
+	if obj.GetKind() == "Table" {
+		rows, _ := obj.Object["rows"].([]interface{})
+		redactor.RedactRows(ctx, resource, rows)
+		return
+	}
+	redactor.Redact(ctx, resource, obj.Object)
 }
 
 func convertEvent(event watch.Event) (*metav1.WatchEvent, error) {
@@ -450,35 +631,64 @@ func emptyResourceVersion(ctx context.Context, gvr schema.GroupVersionResource,
 	return resourceList.GetResourceVersion(), nil
 }
 
-func responseData(resource schema.GroupVersionResource, kind, resourceVersion string, items []unstructured.Unstructured) map[string]interface{} {
+// listMeta returns the metadata for a merged list, with the namespaces that were left out of it.
+func listMeta(resourceVersion, continueToken string, errs *namespaceErrors) map[string]interface{} {
+	meta := map[string]interface{}{
+		"resourceVersion": resourceVersion,
+	}
+	if continueToken != "" {
+		meta["continue"] = continueToken
+	}
+	if errs != nil {
+		errs.addMeta(meta)
+	}
+	return meta
+}
+
+func responseData(resource schema.GroupVersionResource, kind string, meta map[string]interface{}, items []unstructured.Unstructured) map[string]interface{} {
 	return map[string]interface{}{
 		"apiVersion": resource.GroupVersion().String(),
 		"kind":       kind,
-		"metadata": map[string]interface{}{
-			"resourceVersion": resourceVersion,
-		},
-		"items": items,
+		"metadata":   meta,
+		"items":      items,
 	}
 }
 
-func responseTable(resourceVersion string, columnDefinitions interface{}, rows interface{}) *unstructured.UnstructuredList {
+func responseTable(meta map[string]interface{}, columnDefinitions interface{}, rows interface{}) *unstructured.UnstructuredList {
 	list := &unstructured.UnstructuredList{}
 	list.SetUnstructuredContent(map[string]interface{}{
 		"columnDefinitions": columnDefinitions,
 		"rows":              rows,
+		"metadata":          meta,
 	})
 	list.SetAPIVersion("meta.k8s.io/v1")
 	list.SetKind("Table")
-	list.SetResourceVersion(resourceVersion)
 	return list
 }
 
+func addWarning(w http.ResponseWriter, message string) {
+	w.Header().Add("Warning", fmt.Sprintf("%d - %q", warningCode, message))
+}
+
+// returnStatus writes a Kubernetes Status as the error response.
+func returnStatus(w http.ResponseWriter, status metav1.Status) {
+	status.APIVersion = "v1"
+	status.Kind = "Status"
+	if status.Details != nil && status.Details.RetryAfterSeconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(status.Details.RetryAfterSeconds)))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(int(status.Code))
+	returnResp(w, status)
+}
+
 func isErrorAndHandleError(w http.ResponseWriter, err error) bool {
 	if err == nil {
 		return false
 	}
-	if apierrors.IsNotFound(err) {
-		http.Error(w, err.Error(), http.StatusNotFound)
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code != 0 {
+		returnStatus(w, status.Status())
 		return true
 	}
 	http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cmurphy/hns-list/pkg/policy"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func TestNameFieldSelector(t *testing.T) {
+	tests := []struct {
+		name          string
+		fieldSelector string
+		want          string
+	}{
+		{
+			name: "no field selector",
+			want: "metadata.name=ca-bundle",
+		},
+		{
+			name:          "other field selector",
+			fieldSelector: "type=Opaque",
+			want:          "type=Opaque,metadata.name=ca-bundle",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := nameFieldSelector(test.fieldSelector, "ca-bundle")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+	if _, err := nameFieldSelector("type", "ca-bundle"); !apierrors.IsBadRequest(err) {
+		t.Errorf("expected a bad request error, got %v", err)
+	}
+}
+
+func TestNamespaceHandlerByName(t *testing.T) {
+	namespaces := testNamespaceCache(
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+		hncNamespace("c", map[string]string{"c": "0", "a": "1"}),
+		hncNamespace("other", map[string]string{"other": "0"}),
+	)
+	client := &fakeClient{objects: map[string][]string{
+		"a":     {"ca-bundle", "s1"},
+		"b":     {"ca-bundle"},
+		"c":     {"s1"},
+		"other": {"ca-bundle"},
+	}}
+	handler := NamespaceHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, namespaces, nil, nil)
+	vars := map[string]string{"namespace": "a", "resource": "secrets", "name": "ca-bundle"}
+
+	w := httptest.NewRecorder()
+	handler(w, testRequest("/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets/ca-bundle", vars))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	page := testPage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	// the objects with that name in the subtree, as a list
+	if want := []string{"a/ca-bundle", "b/ca-bundle"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("got %v, want %v", page.names(), want)
+	}
+	if len(client.calls) != 3 {
+		t.Errorf("expected a list in each namespace of the subtree, got %+v", client.calls)
+	}
+	for _, call := range client.calls {
+		if call.opts.FieldSelector != "metadata.name=ca-bundle" {
+			t.Errorf("got field selector %q in %s", call.opts.FieldSelector, call.namespace)
+		}
+	}
+
+	client.calls = nil
+	w = httptest.NewRecorder()
+	handler(w, testRequest("/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets/ca-bundle?fieldSelector=type", vars))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for an invalid field selector, want %d", w.Code, http.StatusBadRequest)
+	}
+	if len(client.calls) != 0 {
+		t.Errorf("expected no lists, got %+v", client.calls)
+	}
+}
+
+// streamRecorder is a response writer that passes every write of a stream on to a channel.
+type streamRecorder struct {
+	header http.Header
+	writes chan []byte
+}
+
+func newStreamRecorder() *streamRecorder {
+	return &streamRecorder{header: http.Header{}, writes: make(chan []byte, 10)}
+}
+
+func (s *streamRecorder) Header() http.Header {
+	return s.header
+}
+
+func (s *streamRecorder) WriteHeader(int) {}
+
+func (s *streamRecorder) Write(data []byte) (int, error) {
+	s.writes <- append([]byte{}, data...)
+	return len(data), nil
+}
+
+func (s *streamRecorder) Flush() {}
+
+// nextEvent returns the next JSON watch event written to the stream.
+func (s *streamRecorder) nextEvent(t *testing.T) metav1.WatchEvent {
+	t.Helper()
+	event := metav1.WatchEvent{}
+	select {
+	case data := <-s.writes:
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatalf("invalid watch event %s: %v", data, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for a watch event")
+	}
+	return event
+}
+
+func startWatch(query string, watchers ...watch.Interface) (*streamRecorder, context.CancelFunc, chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets?watch=true"+query, nil).WithContext(ctx)
+	w := newStreamRecorder()
+	done := make(chan struct{})
+	go func() {
+		watchHandler(w, r, secretsResource, fakeAPIs{}, watchers, nil, nil)
+		close(done)
+	}()
+	return w, cancel, done
+}
+
+var expiredStatus = &metav1.Status{Status: metav1.StatusFailure, Code: http.StatusGone, Reason: metav1.StatusReasonExpired, Message: "too old resource version"}
+
+func TestWatchHandlerFailure(t *testing.T) {
+	failing, healthy := watch.NewFake(), watch.NewFake()
+	w, cancel, done := startWatch("", failing, healthy)
+	defer cancel()
+
+	failing.Error(expiredStatus)
+	if event := w.nextEvent(t); event.Type != string(watch.Error) {
+		t.Errorf("got a %s event, want the error", event.Type)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the stream to end")
+	}
+	if !healthy.IsStopped() {
+		t.Errorf("expected every watch to be stopped")
+	}
+}
+
+// Partial result mode only skips namespaces whose watch fails to start, so a watch that fails or closes once the
+// stream is running still ends it, with the error as the last event.
+func TestWatchHandlerPartialFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		fail      func(*watch.FakeWatcher)
+		wantError bool
+	}{
+		{
+			name:      "error",
+			fail:      func(watcher *watch.FakeWatcher) { watcher.Error(expiredStatus) },
+			wantError: true,
+		},
+		{
+			name: "closed",
+			fail: func(watcher *watch.FakeWatcher) { watcher.Stop() },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failing, healthy := watch.NewFake(), watch.NewFake()
+			w, cancel, done := startWatch("&partial=true", failing, healthy)
+			defer cancel()
+
+			test.fail(failing)
+			if test.wantError {
+				if event := w.nextEvent(t); event.Type != string(watch.Error) {
+					t.Errorf("got a %s event, want the error", event.Type)
+				}
+			}
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("expected the stream to end")
+			}
+			if !healthy.IsStopped() {
+				t.Errorf("expected every watch to be stopped")
+			}
+			select {
+			case data := <-w.writes:
+				t.Errorf("expected nothing after the end of the stream, got %s", data)
+			default:
+			}
+		})
+	}
+}
+
+// A watch of a subtree whose namespaces are all excluded stays open like a watch of an empty namespace.
+func TestIdleWatch(t *testing.T) {
+	exclusions, err := policy.NewNamespaceExclusions([]string{"a"}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		// disconnect is whether the client goes away instead of waiting for the timeout
+		disconnect bool
+	}{
+		{
+			name:  "timeout",
+			query: "?watch=true&timeoutSeconds=1",
+		},
+		{
+			name:       "client disconnect",
+			query:      "?watch=true",
+			disconnect: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeClient{}
+			handler := NamespaceHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, testNamespaceCache(testNamespaces("a")...), exclusions, nil)
+			r := testRequest("/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets"+test.query, map[string]string{"namespace": "a", "resource": "secrets"})
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			w := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				handler(w, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+				t.Fatalf("expected the watch to stay open")
+			case <-time.After(200 * time.Millisecond):
+			}
+			if test.disconnect {
+				cancel()
+			}
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("expected the watch to end")
+			}
+			if w.Code != http.StatusOK || w.Body.Len() != 0 {
+				t.Errorf("expected an empty stream, got status %d and %q", w.Code, w.Body.String())
+			}
+			if len(client.calls) != 0 {
+				t.Errorf("expected no requests, got %+v", client.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cmurphy/hns-list/pkg/consts"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+	corecache "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	hierarchyParam = "hierarchy"
+
+	// subnamespaceAnnotation is set by HNC on subnamespaces, with the name of the parent as its value.
+	hncSubnamespaceAnnotation = "hnc.x-k8s.io/subnamespace-of"
+
+	depthAnnotation        = consts.Group + "/depth"
+	parentAnnotation       = consts.Group + "/parent"
+	pathAnnotation         = consts.Group + "/path"
+	subnamespaceAnnotation = consts.Group + "/subnamespace"
+)
+
+// hierarchyColumns are added to Table responses. They have priority 1 so that they are only shown in wide output.
+var hierarchyColumns = []interface{}{
+	map[string]interface{}{
+		"name":        "Depth",
+		"type":        "integer",
+		"format":      "",
+		"description": "Depth of the namespace below the root of its hierarchy.",
+		"priority":    int64(1),
+	},
+	map[string]interface{}{
+		"name":        "Parent",
+		"type":        "string",
+		"format":      "",
+		"description": "Parent of the namespace.",
+		"priority":    int64(1),
+	},
+	map[string]interface{}{
+		"name":        "Path",
+		"type":        "string",
+		"format":      "",
+		"description": "Path from the root of the hierarchy to the namespace.",
+		"priority":    int64(1),
+	},
+	map[string]interface{}{
+		"name":        "Subnamespace",
+		"type":        "boolean",
+		"format":      "",
+		"description": "Whether the namespace is a subnamespace.",
+		"priority":    int64(1),
+	},
+}
+
+// namespaceHierarchy is the position of a namespace in its HNC tree.
+type namespaceHierarchy struct {
+	depth        int
+	parent       string
+	path         string
+	subnamespace bool
+}
+
+// hierarchyLookup returns the position of a namespace in its tree, and false if the namespace is not known.
+type hierarchyLookup func(namespace string) (namespaceHierarchy, bool)
+
+// hierarchyRequested returns whether the client asked for the position of each object's namespace in the tree.
+func hierarchyRequested(r *http.Request) bool {
+	hierarchy, _ := strconv.ParseBool(r.URL.Query().Get(hierarchyParam))
+	return hierarchy
+}
+
+// namespaceHierarchies returns the tree position of each namespace, or nil if the client did not ask for it.
+func namespaceHierarchies(r *http.Request, namespaces []*corev1.Namespace) hierarchyLookup {
+	if !hierarchyRequested(r) {
+		return nil
+	}
+	info := make(map[string]namespaceHierarchy, len(namespaces))
+	for _, ns := range namespaces {
+		info[ns.Name] = hierarchyOf(ns)
+	}
+	return func(namespace string) (namespaceHierarchy, bool) {
+		h, ok := info[namespace]
+		return h, ok
+	}
+}
+
+// cachedHierarchies looks up tree positions in the namespace cache, or is nil if the client did not ask for it.
+func cachedHierarchies(r *http.Request, namespaceCache corecache.NamespaceLister) hierarchyLookup {
+	if !hierarchyRequested(r) {
+		return nil
+	}
+	return func(namespace string) (namespaceHierarchy, bool) {
+		ns, err := namespaceCache.Get(namespace)
+		if err != nil {
+			return namespaceHierarchy{}, false
+		}
+		return hierarchyOf(ns), true
+	}
+}
+
+func hierarchyOf(ns *corev1.Namespace) namespaceHierarchy {
+	path := treePath(ns)
+	h := namespaceHierarchy{
+		depth: len(path) - 1,
+		path:  strings.Join(path, "/"),
+	}
+	if len(path) > 1 {
+		h.parent = path[len(path)-2]
+	}
+	_, h.subnamespace = ns.Annotations[hncSubnamespaceAnnotation]
+	return h
+}
+
+// addHierarchy adds the tree position of each namespace as Table columns or object annotations.
+func addHierarchy(hierarchy hierarchyLookup, columns []interface{}, items []unstructured.Unstructured, rows []interface{}) []interface{} {
+	if hierarchy == nil {
+		return columns
+	}
+	for i := range items {
+		h, ok := hierarchy(items[i].GetNamespace())
+		if !ok {
+			continue
+		}
+		annotations := items[i].GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[depthAnnotation] = strconv.Itoa(h.depth)
+		annotations[parentAnnotation] = h.parent
+		annotations[pathAnnotation] = h.path
+		annotations[subnamespaceAnnotation] = strconv.FormatBool(h.subnamespace)
+		items[i].SetAnnotations(annotations)
+	}
+	if columns == nil {
+		return columns
+	}
+	for _, row := range rows {
+		rowMap, ok := row.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cells, _ := rowMap["cells"].([]interface{})
+		h, _ := hierarchy(rowObject(row).GetNamespace())
+		rowMap["cells"] = append(cells, int64(h.depth), h.parent, h.path, h.subnamespace)
+	}
+	withHierarchy := make([]interface{}, 0, len(columns)+len(hierarchyColumns))
+	withHierarchy = append(withHierarchy, columns...)
+	return append(withHierarchy, hierarchyColumns...)
+}
+
+// addEventHierarchy adds the tree position of the namespace to the object of a watch event.
+func addEventHierarchy(hierarchy hierarchyLookup, event watch.Event) {
+	obj, ok := event.Object.(*unstructured.Unstructured)
+	if !ok || hierarchy == nil || event.Type == watch.Error || event.Type == watch.Bookmark {
+		return
+	}
+	if obj.GetKind() != "Table" {
+		addHierarchy(hierarchy, nil, []unstructured.Unstructured{*obj}, nil)
+		return
+	}
+	columns, _ := obj.Object["columnDefinitions"].([]interface{})
+	rows, _ := obj.Object["rows"].([]interface{})
+	withHierarchy := addHierarchy(hierarchy, append([]interface{}{}, columns...), nil, rows)
+	if len(columns) > 0 {
+		obj.Object["columnDefinitions"] = withHierarchy
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// hierarchyNamespaces are a root namespace a with a subnamespace b.
+func hierarchyNamespaces() []*corev1.Namespace {
+	a := hncNamespace("a", map[string]string{"a": "0"})
+	b := hncNamespace("b", map[string]string{"b": "0", "a": "1"})
+	b.Annotations = map[string]string{hncSubnamespaceAnnotation: "a"}
+	return []*corev1.Namespace{a, b}
+}
+
+// hierarchyHandlers are the subtree and cluster-wide handlers, which add the hierarchy from the subtree or from the
+// namespace cache.
+var hierarchyHandlers = []struct {
+	name    string
+	handler func(clientGetter) http.HandlerFunc
+	path    string
+	vars    map[string]string
+}{
+	{
+		name: "subtree",
+		handler: func(clients clientGetter) http.HandlerFunc {
+			return NamespaceHandler(clients, fakeAPIs{}, testNamespaceCache(hierarchyNamespaces()...), nil, nil)
+		},
+		path: "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets",
+		vars: map[string]string{"namespace": "a", "resource": "secrets"},
+	},
+	{
+		name: "cluster-wide",
+		handler: func(clients clientGetter) http.HandlerFunc {
+			return Forwarder(clients, fakeAPIs{}, testNamespaceCache(hierarchyNamespaces()...), nil, nil)
+		},
+		path: "/apis/resources.hns.demo/v1alpha1/secrets",
+		vars: map[string]string{"resource": "secrets"},
+	},
+}
+
+func TestHierarchyTable(t *testing.T) {
+	for _, test := range hierarchyHandlers {
+		for _, query := range []string{"", "?hierarchy=true"} {
+			t.Run(test.name+query, func(t *testing.T) {
+				client := &fakeClient{
+					objects: map[string][]string{"a": {"s1"}, "b": {"s2"}},
+					columns: map[string][]string{"": {"Name"}, "a": {"Name"}, "b": {"Name"}},
+				}
+				handler := test.handler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}))
+				w := httptest.NewRecorder()
+				handler(w, testRequest(test.path+query, test.vars))
+				if w.Code != http.StatusOK {
+					t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+				}
+				table := struct {
+					ColumnDefinitions []struct {
+						Name string `json:"name"`
+					} `json:"columnDefinitions"`
+					Rows []struct {
+						Cells []interface{} `json:"cells"`
+					} `json:"rows"`
+				}{}
+				if err := json.Unmarshal(w.Body.Bytes(), &table); err != nil {
+					t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+				}
+				columns := make([]string, 0, len(table.ColumnDefinitions))
+				for _, column := range table.ColumnDefinitions {
+					columns = append(columns, column.Name)
+				}
+				cells := make([][]interface{}, 0, len(table.Rows))
+				for _, row := range table.Rows {
+					cells = append(cells, row.Cells)
+				}
+				wantColumns := []string{"Name"}
+				wantCells := [][]interface{}{{"Name"}, {"Name"}}
+				if query != "" {
+					wantColumns = []string{"Name", "Depth", "Parent", "Path", "Subnamespace"}
+					wantCells = [][]interface{}{{"Name", float64(0), "", "a", false}, {"Name", float64(1), "a", "a/b", true}}
+				}
+				if !reflect.DeepEqual(columns, wantColumns) {
+					t.Errorf("got columns %v, want %v", columns, wantColumns)
+				}
+				if !reflect.DeepEqual(cells, wantCells) {
+					t.Errorf("got cells %v, want %v", cells, wantCells)
+				}
+			})
+		}
+	}
+}
+
+func TestHierarchyAnnotations(t *testing.T) {
+	for _, test := range hierarchyHandlers {
+		for _, query := range []string{"", "?hierarchy=true"} {
+			t.Run(test.name+query, func(t *testing.T) {
+				client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s2"}}}
+				handler := test.handler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}))
+				w := httptest.NewRecorder()
+				handler(w, testRequest(test.path+query, test.vars))
+				if w.Code != http.StatusOK {
+					t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+				}
+				list := struct {
+					Items []struct {
+						Metadata struct {
+							Annotations map[string]string `json:"annotations"`
+						} `json:"metadata"`
+					} `json:"items"`
+				}{}
+				if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+					t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+				}
+				annotations := make([]map[string]string, 0, len(list.Items))
+				for _, item := range list.Items {
+					annotations = append(annotations, item.Metadata.Annotations)
+				}
+				want := []map[string]string{nil, nil}
+				if query != "" {
+					want = []map[string]string{
+						{depthAnnotation: "0", parentAnnotation: "", pathAnnotation: "a", subnamespaceAnnotation: "false"},
+						{depthAnnotation: "1", parentAnnotation: "a", pathAnnotation: "a/b", subnamespaceAnnotation: "true"},
+					}
+				}
+				if !reflect.DeepEqual(annotations, want) {
+					t.Errorf("got annotations %v, want %v", annotations, want)
+				}
+			})
+		}
+	}
+}
+
+func TestAddEventHierarchy(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?hierarchy=true", nil)
+	hierarchy := namespaceHierarchies(r, hierarchyNamespaces())
+	table := func(columns ...string) *unstructured.Unstructured {
+		list := &unstructured.UnstructuredList{Items: []unstructured.Unstructured{*namespacedObject("b", "s1")}}
+		obj := &unstructured.Unstructured{Object: fakeTable(list, []string{"Name"}).Object}
+		if len(columns) == 0 {
+			delete(obj.Object, "columnDefinitions")
+		}
+		return obj
+	}
+	tests := []struct {
+		name        string
+		hierarchy   hierarchyLookup
+		event       watch.Event
+		wantColumns int
+		wantCells   int
+		annotated   bool
+	}{
+		{
+			name:      "object",
+			hierarchy: hierarchy,
+			event:     watch.Event{Type: watch.Added, Object: namespacedObject("b", "s1")},
+			annotated: true,
+		},
+		{
+			name:        "first Table event",
+			hierarchy:   hierarchy,
+			event:       watch.Event{Type: watch.Added, Object: table("Name")},
+			wantColumns: 5,
+			wantCells:   5,
+		},
+		{
+			name:      "later Table event",
+			hierarchy: hierarchy,
+			event:     watch.Event{Type: watch.Modified, Object: table()},
+			wantCells: 5,
+		},
+		{
+			name:  "not requested",
+			event: watch.Event{Type: watch.Added, Object: namespacedObject("b", "s1")},
+		},
+		{
+			name:      "bookmark",
+			hierarchy: hierarchy,
+			event:     watch.Event{Type: watch.Bookmark, Object: namespacedObject("b", "s1")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addEventHierarchy(test.hierarchy, test.event)
+			obj := test.event.Object.(*unstructured.Unstructured)
+			if annotated := obj.GetAnnotations()[pathAnnotation] == "a/b"; annotated != test.annotated {
+				t.Errorf("got annotated %t, want %t", annotated, test.annotated)
+			}
+			if obj.GetKind() != "Table" {
+				return
+			}
+			columns, _ := obj.Object["columnDefinitions"].([]interface{})
+			if len(columns) != test.wantColumns {
+				t.Errorf("got %d columns, want %d", len(columns), test.wantColumns)
+			}
+			rows, _ := obj.Object["rows"].([]interface{})
+			cells, _ := rows[0].(map[string]interface{})["cells"].([]interface{})
+			if len(cells) != test.wantCells {
+				t.Errorf("got %d cells, want %d", len(cells), test.wantCells)
+			}
+		})
+	}
+}
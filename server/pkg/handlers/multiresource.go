@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/cmurphy/hns-list/pkg/audit"
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"github.com/cmurphy/hns-list/pkg/redaction"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// resourceNames splits a comma-separated list of resources and expands any categories.
+func resourceNames(resourceVar string, apis apiresources.APIResourceWatcher) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	for _, name := range strings.Split(resourceVar, ",") {
+		if _, ok := apis.Get(splitResourceName(name)); ok {
+			add(name)
+			continue
+		}
+		category := apis.GetCategory(name)
+		if len(category) == 0 {
+			add(name)
+			continue
+		}
+		for _, resource := range category {
+			add(resource.Name)
+		}
+	}
+	return names
+}
+
+// gvrsFromVars returns the resources requested in the resource path segment.
+func gvrsFromVars(vars map[string]string, apis apiresources.APIResourceWatcher) ([]schema.GroupVersionResource, error) {
+	names := resourceNames(vars["resource"], apis)
+	resources := make([]schema.GroupVersionResource, 0, len(names))
+	for _, name := range names {
+		resource, err := gvrFromVars(map[string]string{"resource": name}, apis)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("could not find resource %s", vars["resource"])
+	}
+	return resources, nil
+}
+
+// multiResourceHandler lists several resources in each of the given namespaces.
+func multiResourceHandler(w http.ResponseWriter, r *http.Request, clientGetter clientGetter, resources []schema.GroupVersionResource, namespaces []*corev1.Namespace, opts metav1.ListOptions, redactor *redaction.Redactor) {
+	consistent, _ := strconv.ParseBool(r.URL.Query().Get(consistentParam))
+	stream, _ := strconv.ParseBool(r.URL.Query().Get(streamParam))
+	if opts.Watch || r.URL.Query().Has(summaryParam) || opts.Limit > 0 || opts.Continue != "" || consistent || stream {
+		isErrorAndHandleError(w, apierrors.NewBadRequest("watch, summary, limit, continue, consistent and stream are only supported for a single resource"))
+		return
+	}
+	// the combined list is only written as JSON
+	if _, ok := negotiate(r, false); !ok {
+		http.Error(w, errUnsupportedContentType.Error(), clientErrorStatus(errUnsupportedContentType))
+		return
+	}
+	less, err := sorter(r.URL.Query().Get(sortByParam), namespaceTreePaths(namespaces))
+	if isErrorAndHandleError(w, err) {
+		return
+	}
+	clients := make([]dynamic.NamespaceableResourceInterface, len(resources))
+	for i, resource := range resources {
+		clients[i], err = clientGetter(r, resource)
+		if err != nil {
+			http.Error(w, err.Error(), clientErrorStatus(err))
+			return
+		}
+	}
+	audit.SetNamespacesQueried(r.Context(), len(namespaces))
+	if isErrorAndHandleError(w, ratelimit.ReserveNamespaces(r.Context(), len(namespaces)*len(resources))) {
+		return
+	}
+
+	fanOuts := make([]namespaceListResults, len(resources))
+	eg, ctx := errgroup.WithContext(r.Context())
+	sem := semaphore.NewWeighted(ratelimit.NamespaceWorkers(r.Context()))
+	for i := range resources {
+		i := i
+		eg.Go(func() error {
+			var err error
+			fanOuts[i], err = listNamespaces(ctx, clients[i], namespaces, opts, sem, partialResults(r))
+			return err
+		})
+	}
+	if isErrorAndHandleError(w, eg.Wait()) {
+		return
+	}
+
+	// like kubectl, resources the user is not allowed to list in any of the namespaces are left out, and the request
+	// only fails if that is every resource
+	errs := newNamespaceErrors(partialResults(r))
+	forbidden := make(map[int]bool)
+	var forbiddenErr error
+	for i, fanOut := range fanOuts {
+		err := fanOut.errs.err(len(namespaces))
+		if apierrors.IsForbidden(err) {
+			forbidden[i] = true
+			forbiddenErr = err
+			continue
+		}
+		if isErrorAndHandleError(w, err) {
+			return
+		}
+		errs.merge(fanOut.errs)
+	}
+	if len(forbidden) == len(resources) {
+		isErrorAndHandleError(w, forbiddenErr)
+		return
+	}
+	for i, resource := range resources {
+		if forbidden[i] {
+			addWarning(w, fmt.Sprintf("skipped resource %s: access forbidden", resource.GroupResource()))
+		}
+	}
+	errs.addWarnings(w)
+
+	hierarchy := namespaceHierarchies(r, namespaces)
+	items := make([]interface{}, 0)
+	returned := 0
+	for i, resource := range resources {
+		if forbidden[i] {
+			continue
+		}
+		columns, itemsList, rowList := mergeLists(fanOuts[i].results)
+		for j := range itemsList {
+			redactor.Redact(r.Context(), resource, itemsList[j].Object)
+		}
+		redactor.RedactRows(r.Context(), resource, rowList)
+		sortItems(itemsList, less)
+		sortRows(rowList, less)
+		columns = addHierarchy(hierarchy, columns, itemsList, rowList)
+		returned += len(itemsList) + len(rowList)
+		if columns != nil {
+			stripRowObjects(r, rowList)
+			items = append(items, responseTable(listMeta(strconv.Itoa(fanOuts[i].resourceVersion), "", nil), columns, rowList))
+			continue
+		}
+		for _, item := range itemsList {
+			items = append(items, item.Object)
+		}
+	}
+
+	audit.AddItemsReturned(r.Context(), returned)
+	w.Header().Set("Content-Type", "application/json")
+	returnResp(w, map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   listMeta("", "", errs),
+		"items":      items,
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var configMapsResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+func listAll(t *testing.T, secrets, configMaps *fakeClient, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	namespaces := testNamespaceCache(
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+	)
+	clients := map[schema.GroupVersionResource]*fakeClient{secretsResource: secrets, configMapsResource: configMaps}
+	handler := NamespaceHandler(testClientGetter(clients), fakeAPIs{}, namespaces, nil, nil)
+	w := httptest.NewRecorder()
+	handler(w, testRequest("/apis/resources.hns.demo/v1alpha1/namespaces/a/all?"+query, map[string]string{"namespace": "a", "resource": "all"}))
+	return w
+}
+
+func TestMultiResourceForbiddenResource(t *testing.T) {
+	secrets := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s2"}}}
+	configMaps := &fakeClient{
+		objects:   map[string][]string{"a": {"c1"}},
+		forbidden: map[string]bool{"a": true, "b": true},
+	}
+	w := listAll(t, secrets, configMaps, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	page := testPage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	if want := []string{"a/s1", "b/s2"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("got %v, want %v", page.names(), want)
+	}
+	// the namespaces are not skipped, only the resource
+	if len(page.Metadata.SkippedNamespaces) != 0 {
+		t.Errorf("expected no skipped namespaces, got %v", page.Metadata.SkippedNamespaces)
+	}
+	warnings := w.Header().Values("Warning")
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "skipped resource configmaps") {
+		t.Errorf("expected a warning for configmaps, got %v", warnings)
+	}
+}
+
+func TestMultiResourceAllForbidden(t *testing.T) {
+	forbidden := map[string]bool{"a": true, "b": true}
+	w := listAll(t, &fakeClient{forbidden: forbidden}, &fakeClient{forbidden: forbidden}, "")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestMultiResourceUnsupported(t *testing.T) {
+	for _, query := range []string{"watch=true", "summary=counts", "limit=1", "continue=abc", "consistent=true", "stream=true"} {
+		secrets := &fakeClient{objects: map[string][]string{"a": {"s1"}}}
+		configMaps := &fakeClient{objects: map[string][]string{"a": {"c1"}}}
+		if w := listAll(t, secrets, configMaps, query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+		if len(secrets.calls) > 0 || len(configMaps.calls) > 0 {
+			t.Errorf("%s: expected no lists", query)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/cmurphy/hns-list/pkg/authz"
+	"github.com/cmurphy/hns-list/pkg/consts"
+	"github.com/cmurphy/hns-list/pkg/policy"
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"github.com/cmurphy/hns-list/pkg/redaction"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	corecache "k8s.io/client-go/listers/core/v1"
+)
+
+// MyNamespacesRoute is the name of the route served by MyNamespacesHandler.
+const MyNamespacesRoute = "mynamespaces"
+
+// MyNamespacesHandler lists or watches a resource in every namespace the user has access to.
+func MyNamespacesHandler(clientGetter clientGetter, apis apiresources.APIResourceWatcher, namespaceCache corecache.NamespaceLister, exclusions *policy.NamespaceExclusions, redactor *redaction.Redactor, authorizer authz.Authorizer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logrus.Tracef("handling request %s\n", r.URL.Path)
+
+		vars := mux.Vars(r)
+		resource, err := gvrFromVars(vars, apis)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		user, ok := request.UserFrom(r.Context())
+		if !ok {
+			http.Error(w, errNoUser.Error(), http.StatusUnauthorized)
+			return
+		}
+		resourceClient, err := clientGetter(r, resource)
+		if err != nil {
+			http.Error(w, err.Error(), clientErrorStatus(err))
+			return
+		}
+
+		opts := metav1.ListOptions{}
+		paramCodec.DecodeParameters(r.URL.Query(), metav1.SchemeGroupVersion, &opts)
+
+		selector, err := namespaceSelector(r.URL.Query())
+		if isErrorAndHandleError(w, err) {
+			return
+		}
+		namespaces, err := namespaceCache.List(selector)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		namespaces = exclusions.Filter(namespaces)
+		// the access reviews cost API calls too, so every candidate namespace is charged before they are sent, on
+		// top of the charge for the namespaces that are then queried
+		if isErrorAndHandleError(w, ratelimit.ReserveNamespaces(r.Context(), len(namespaces))) {
+			return
+		}
+		namespaces, err = accessibleNamespaces(r.Context(), authorizer, user, vars["resource"], resource, requestVerb(r), namespaces)
+		if isErrorAndHandleError(w, err) {
+			return
+		}
+		namespacesHandler(w, r, resource, resourceClient, namespaces, opts, apis, redactor)
+	}
+}
+
+// accessibleNamespaces returns the namespaces where the user may use both the resource and the hns resource.
+func accessibleNamespaces(ctx context.Context, authorizer authz.Authorizer, user user.Info, hnsResource string, resource schema.GroupVersionResource, verb string, namespaces []*corev1.Namespace) ([]*corev1.Namespace, error) {
+	allowed := make([]bool, len(namespaces))
+	eg, ctx := errgroup.WithContext(ctx)
+	sem := semaphore.NewWeighted(ratelimit.NamespaceWorkers(ctx))
+	for i, ns := range namespaces {
+		i, ns := i, ns.Name
+		if err := sem.Acquire(ctx, 1); err != nil {
+			// the context is only done if a review failed or the client went away, which Wait reports below
+			eg.Go(func() error { return err })
+			break
+		}
+		eg.Go(func() error {
+			defer sem.Release(1)
+			for _, attributes := range []authorizationv1.ResourceAttributes{
+				{Namespace: ns, Verb: verb, Group: consts.Group, Version: consts.Version, Resource: hnsResource},
+				{Namespace: ns, Verb: verb, Group: resource.Group, Version: resource.Version, Resource: resource.Resource},
+			} {
+				ok, _, err := authorizer.Authorize(ctx, user, attributes)
+				if err != nil || !ok {
+					return err
+				}
+			}
+			allowed[i] = true
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	accessible := make([]*corev1.Namespace, 0)
+	for i, ns := range namespaces {
+		if allowed[i] {
+			accessible = append(accessible, ns)
+		}
+	}
+	return accessible, nil
+}
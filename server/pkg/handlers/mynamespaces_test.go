@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cmurphy/hns-list/pkg/consts"
+	"github.com/cmurphy/hns-list/pkg/policy"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// myNamespacesAuthorizer allows listing secrets in the resources.hns.demo group in a, b and c, and in the core group
+// in a, c and d.
+var myNamespacesAuthorizer = &fakeAuthorizer{allowed: map[string]bool{
+	"a/" + consts.Group + "/secrets/list": true,
+	"b/" + consts.Group + "/secrets/list": true,
+	"c/" + consts.Group + "/secrets/list": true,
+	"a//secrets/list":                     true,
+	"c//secrets/list":                     true,
+	"d//secrets/list":                     true,
+}}
+
+func TestMyNamespacesHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		exclusions  []string
+		want        []string
+		wantQueried []string
+	}{
+		{
+			name:        "namespaces with both permissions",
+			want:        []string{"a/s1", "c/s1"},
+			wantQueried: []string{"a", "c"},
+		},
+		{
+			name:        "excluded namespace",
+			exclusions:  []string{"c"},
+			want:        []string{"a/s1"},
+			wantQueried: []string{"a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s1"}, "c": {"s1"}, "d": {"s1"}}}
+			exclusions, err := policy.NewNamespaceExclusions(test.exclusions, nil, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			handler := MyNamespacesHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, testNamespaceCache(testNamespaces("a", "b", "c", "d")...), exclusions, nil, myNamespacesAuthorizer)
+			w := httptest.NewRecorder()
+			handler(w, testRequest("/apis/resources.hns.demo/v1alpha1/mynamespaces/secrets", map[string]string{"resource": "secrets"}))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			page := testPage{}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+			}
+			if !reflect.DeepEqual(page.names(), test.want) {
+				t.Errorf("got %v, want %v", page.names(), test.want)
+			}
+			queried := make([]string, 0, len(client.calls))
+			for _, call := range client.calls {
+				queried = append(queried, call.namespace)
+			}
+			sort.Strings(queried)
+			if !reflect.DeepEqual(queried, test.wantQueried) {
+				t.Errorf("got lists in %v, want %v", queried, test.wantQueried)
+			}
+		})
+	}
+}
+
+func TestMyNamespacesHandlerNoAccess(t *testing.T) {
+	client := &fakeClient{objects: map[string][]string{"b": {"s1"}, "d": {"s1"}}}
+	handler := MyNamespacesHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, testNamespaceCache(testNamespaces("b", "d")...), nil, nil, myNamespacesAuthorizer)
+	w := httptest.NewRecorder()
+	handler(w, testRequest("/apis/resources.hns.demo/v1alpha1/mynamespaces/secrets", map[string]string{"resource": "secrets"}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	page := testPage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	if len(page.Items) != 0 {
+		t.Errorf("expected an empty list, got %v", page.names())
+	}
+	// only the resource version of the empty list is read, cluster-wide
+	for _, call := range client.calls {
+		if call.namespace != "" {
+			t.Errorf("expected no namespace lists, got a list in %s", call.namespace)
+		}
+	}
+}
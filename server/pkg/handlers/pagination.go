@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/cmurphy/hns-list/pkg/audit"
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"github.com/cmurphy/hns-list/pkg/redaction"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// continueToken is the position of a paginated list across namespaces.
+type continueToken struct {
+	// Namespace is the namespace to resume from.
+	Namespace string `json:"ns"`
+	// Continue is the namespace's own continue token if it was only partly listed.
+	Continue string `json:"continue,omitempty"`
+	// ResourceVersion is the resource version of the first page, which all later pages are listed at.
+	ResourceVersion string `json:"rv"`
+}
+
+func encodeContinueToken(token continueToken) (string, error) {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeContinueToken(encoded string) (continueToken, error) {
+	token := continueToken{}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return token, apierrors.NewBadRequest("invalid continue token")
+	}
+	if err := json.Unmarshal(data, &token); err != nil || token.Namespace == "" || token.ResourceVersion == "" {
+		return token, apierrors.NewBadRequest("invalid continue token")
+	}
+	return token, nil
+}
+
+// paginatedListHandler lists a page of at most opts.Limit items, walking the namespaces in name order.
+func paginatedListHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, apis apiresources.APIResourceWatcher, redactor *redaction.Redactor, less objectLess) {
+	sorted := make([]*corev1.Namespace, len(namespaces))
+	copy(sorted, namespaces)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	token := continueToken{}
+	if opts.Continue != "" {
+		var err error
+		token, err = decodeContinueToken(opts.Continue)
+		if isErrorAndHandleError(w, err) {
+			return
+		}
+	}
+	start := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i].Name >= token.Namespace
+	})
+
+	results := make([]namespaceList, 0)
+	returned := int64(0)
+	errs := newNamespaceErrors(partialResults(r))
+	resourceVersion := token.ResourceVersion
+	// the resource version is not known yet if every namespace so far was skipped
+	var nextToken *continueToken
+	queried := 0
+	for i := start; i < len(sorted); i++ {
+		ns := sorted[i].Name
+		remaining := opts.Limit - returned
+		if remaining <= 0 {
+			nextToken = &continueToken{Namespace: ns}
+			break
+		}
+		if err := ratelimit.ReserveNamespaces(r.Context(), 1); err != nil {
+			if queried == 0 {
+				isErrorAndHandleError(w, err)
+				return
+			}
+			// return what we have so far and let the client continue later
+			nextToken = &continueToken{Namespace: ns}
+			break
+		}
+		queried++
+		nsOpts := opts
+		nsOpts.Limit = remaining
+		nsOpts.Continue = ""
+		if ns == token.Namespace && token.Continue != "" {
+			nsOpts.Continue = token.Continue
+			nsOpts.ResourceVersion = ""
+			nsOpts.ResourceVersionMatch = ""
+		} else if resourceVersion != "" && resourceVersion != "0" {
+			nsOpts.ResourceVersion = resourceVersion
+			nsOpts.ResourceVersionMatch = metav1.ResourceVersionMatchExact
+		}
+		resourcesForNamespace, err := client.Namespace(ns).List(r.Context(), nsOpts)
+		// an expired resource version means the continue token is too old, which the client has to handle
+		if err != nil && !apierrors.IsResourceExpired(err) && !apierrors.IsGone(err) {
+			err = errs.add(ns, err)
+			if err == nil {
+				continue
+			}
+		}
+		if isErrorAndHandleError(w, err) {
+			return
+		}
+		if resourceVersion == "" {
+			resourceVersion = resourcesForNamespace.GetResourceVersion()
+		}
+		rows, _ := resourcesForNamespace.Object["rows"].([]interface{})
+		returned += int64(len(rows) + len(resourcesForNamespace.Items))
+		results = append(results, namespaceList{namespace: ns, list: resourcesForNamespace})
+		if nsContinue := resourcesForNamespace.GetContinue(); nsContinue != "" {
+			nextToken = &continueToken{Namespace: ns, Continue: nsContinue}
+			break
+		}
+	}
+	audit.SetNamespacesQueried(r.Context(), queried)
+
+	// only a list that covered every namespace in one page can tell that none of them could be listed
+	if complete := opts.Continue == "" && nextToken == nil; complete && isErrorAndHandleError(w, errs.err(queried)) {
+		return
+	}
+	errs.addWarnings(w)
+
+	columns, itemsList, rowList := mergeLists(results)
+	for i := range itemsList {
+		redactor.Redact(r.Context(), resource, itemsList[i].Object)
+	}
+	redactor.RedactRows(r.Context(), resource, rowList)
+	if r.URL.Query().Get(sortByParam) != "" {
+		sortItems(itemsList, less)
+		sortRows(rowList, less)
+	}
+	columns = addHierarchy(namespaceHierarchies(r, namespaces), columns, itemsList, rowList)
+
+	if resourceVersion == "" {
+		var err error
+		resourceVersion, err = emptyResourceVersion(r.Context(), resource, client)
+		if apierrors.IsForbidden(err) {
+			resourceVersion, err = "0", nil
+		}
+		if isErrorAndHandleError(w, err) {
+			return
+		}
+	}
+	next := ""
+	if nextToken != nil {
+		nextToken.ResourceVersion = resourceVersion
+		next, _ = encodeContinueToken(*nextToken)
+	}
+	writeList(w, r, resource, apis, listMeta(resourceVersion, next, errs), columns, itemsList, rowList)
+}
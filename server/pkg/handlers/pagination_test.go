@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type testPage struct {
+	Metadata struct {
+		ResourceVersion   string   `json:"resourceVersion"`
+		Continue          string   `json:"continue"`
+		SkippedNamespaces []string `json:"skippedNamespaces"`
+	} `json:"metadata"`
+	Items []struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+			Name      string `json:"name"`
+		} `json:"metadata"`
+	} `json:"items"`
+}
+
+func (p testPage) names() []string {
+	names := make([]string, 0, len(p.Items))
+	for _, item := range p.Items {
+		names = append(names, item.Metadata.Namespace+"/"+item.Metadata.Name)
+	}
+	return names
+}
+
+func listPage(t *testing.T, client *fakeClient, namespaces []*corev1.Namespace, limit int64, continueToken string) (int, testPage) {
+	t.Helper()
+	client.calls = nil
+	r := httptest.NewRequest(http.MethodGet, "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets", nil)
+	w := httptest.NewRecorder()
+	opts := metav1.ListOptions{Limit: limit, Continue: continueToken}
+	paginatedListHandler(w, r, secretsResource, client, namespaces, opts, fakeAPIs{}, nil, nil)
+	page := testPage{}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, page
+}
+
+func TestContinueTokenRoundTrip(t *testing.T) {
+	tokens := []continueToken{
+		{Namespace: "a", ResourceVersion: "100"},
+		{Namespace: "team-a", Continue: "eyJ2IjoibWV0YS5rOHMuaW8vdjEifQ", ResourceVersion: "12345"},
+	}
+	for _, token := range tokens {
+		encoded, err := encodeContinueToken(token)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		decoded, err := decodeContinueToken(encoded)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if decoded != token {
+			t.Errorf("got %+v, want %+v", decoded, token)
+		}
+	}
+}
+
+func TestDecodeContinueTokenInvalid(t *testing.T) {
+	valid, _ := encodeContinueToken(continueToken{Namespace: "a", ResourceVersion: "100"})
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{
+			name:  "invalid base64",
+			token: "not a token!",
+		},
+		{
+			name:  "padded base64",
+			token: base64.URLEncoding.EncodeToString([]byte(`{"ns":"a","rv":"1"}`)),
+		},
+		{
+			name:  "truncated",
+			token: valid[:len(valid)-3],
+		},
+		{
+			name:  "not JSON",
+			token: base64.RawURLEncoding.EncodeToString([]byte("a:100")),
+		},
+		{
+			name:  "wrong types",
+			token: base64.RawURLEncoding.EncodeToString([]byte(`{"ns":1,"rv":100}`)),
+		},
+		{
+			name:  "missing namespace",
+			token: base64.RawURLEncoding.EncodeToString([]byte(`{"rv":"100"}`)),
+		},
+		{
+			name:  "missing resource version",
+			token: base64.RawURLEncoding.EncodeToString([]byte(`{"ns":"a"}`)),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := decodeContinueToken(test.token)
+			if !apierrors.IsBadRequest(err) {
+				t.Errorf("expected a bad request error, got %v", err)
+			}
+			client := &fakeClient{objects: map[string][]string{"a": {"s1"}}}
+			if code, _ := listPage(t, client, testNamespaces("a"), 1, test.token); code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", code, http.StatusBadRequest)
+			}
+			if len(client.calls) != 0 {
+				t.Errorf("expected no lists, got %v", client.calls)
+			}
+		})
+	}
+}
+
+func TestPaginatedListResume(t *testing.T) {
+	client := &fakeClient{
+		objects: map[string][]string{
+			"a": {"s1", "s2", "s3"},
+			"b": {"s1"},
+			"c": {"s1", "s2"},
+		},
+	}
+	namespaces := testNamespaces("c", "a", "b")
+
+	code, page := listPage(t, client, namespaces, 2, "")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if want := []string{"a/s1", "a/s2"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("first page: got %v, want %v", page.names(), want)
+	}
+	token, err := decodeContinueToken(page.Metadata.Continue)
+	if err != nil {
+		t.Fatalf("invalid continue token: %v", err)
+	}
+	// the first page stops inside a, so the token keeps the continue token of a
+	if want := (continueToken{Namespace: "a", Continue: "2", ResourceVersion: "100"}); token != want {
+		t.Errorf("first page: got token %+v, want %+v", token, want)
+	}
+
+	code, page = listPage(t, client, namespaces, 2, page.Metadata.Continue)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if want := []string{"a/s3", "b/s1"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("second page: got %v, want %v", page.names(), want)
+	}
+	wantCalls := []fakeListCall{
+		// resuming inside a namespace uses its own continue token, which already holds the resource version
+		{namespace: "a", opts: metav1.ListOptions{Limit: 2, Continue: "2"}},
+		{namespace: "b", opts: metav1.ListOptions{Limit: 1, ResourceVersion: "100", ResourceVersionMatch: metav1.ResourceVersionMatchExact}},
+	}
+	if !reflect.DeepEqual(client.calls, wantCalls) {
+		t.Errorf("second page: got calls %+v, want %+v", client.calls, wantCalls)
+	}
+	token, err = decodeContinueToken(page.Metadata.Continue)
+	if err != nil {
+		t.Fatalf("invalid continue token: %v", err)
+	}
+	// the second page ends at the boundary between b and c
+	if want := (continueToken{Namespace: "c", ResourceVersion: "100"}); token != want {
+		t.Errorf("second page: got token %+v, want %+v", token, want)
+	}
+
+	code, page = listPage(t, client, namespaces, 2, page.Metadata.Continue)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	if want := []string{"c/s1", "c/s2"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("third page: got %v, want %v", page.names(), want)
+	}
+	wantCalls = []fakeListCall{
+		{namespace: "c", opts: metav1.ListOptions{Limit: 2, ResourceVersion: "100", ResourceVersionMatch: metav1.ResourceVersionMatchExact}},
+	}
+	if !reflect.DeepEqual(client.calls, wantCalls) {
+		t.Errorf("third page: got calls %+v, want %+v", client.calls, wantCalls)
+	}
+	if page.Metadata.Continue != "" {
+		t.Errorf("third page: expected the last page, got continue token %q", page.Metadata.Continue)
+	}
+}
+
+func TestPaginatedListForbidden(t *testing.T) {
+	client := &fakeClient{
+		objects:   map[string][]string{"a": {"s1", "s2"}},
+		forbidden: map[string]bool{"b": true, "c": true},
+	}
+
+	if code, _ := listPage(t, client, testNamespaces("b", "c"), 2, ""); code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", code, http.StatusForbidden)
+	}
+
+	// a later page that only covers forbidden namespaces is empty and ends the list
+	token, _ := encodeContinueToken(continueToken{Namespace: "b", ResourceVersion: "100"})
+	code, page := listPage(t, client, testNamespaces("a", "b", "c"), 2, token)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", code, http.StatusOK)
+	}
+	if len(page.Items) != 0 || page.Metadata.Continue != "" {
+		t.Errorf("expected an empty last page, got %v with continue token %q", page.names(), page.Metadata.Continue)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(page.Metadata.SkippedNamespaces, want) {
+		t.Errorf("got skipped namespaces %v, want %v", page.Metadata.SkippedNamespaces, want)
+	}
+}
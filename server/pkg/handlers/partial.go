@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	partialParam = "partial"
+	// failedNamespacesKey is the list metadata field that holds the failed namespaces.
+	failedNamespacesKey = "failedNamespaces"
+)
+
+// failedNamespace is a namespace that could not be listed, as reported in the list metadata.
+type failedNamespace struct {
+	Namespace string `json:"namespace"`
+	Error     string `json:"error"`
+}
+
+// partialResults returns whether the client asked for partial results.
+func partialResults(r *http.Request) bool {
+	partial, _ := strconv.ParseBool(r.URL.Query().Get(partialParam))
+	return partial
+}
+
+// namespaceErrors collects the namespaces left out of a response: those the user is not allowed to read, which are
+// always skipped, and in partial result mode those that failed for any other reason. It is safe for concurrent use.
+type namespaceErrors struct {
+	partial bool
+
+	lock    sync.Mutex
+	skipped []string
+	// forbiddenErr is one of the errors returned by the skipped namespaces.
+	forbiddenErr error
+	failed       []namespaceError
+}
+
+func newNamespaceErrors(partial bool) *namespaceErrors {
+	return &namespaceErrors{partial: partial}
+}
+
+// add records a namespace's error, and returns it if it fails the whole request.
+func (e *namespaceErrors) add(namespace string, err error) error {
+	if err == nil {
+		return nil
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if apierrors.IsForbidden(err) {
+		logrus.Debugf("skipping forbidden namespace %s: %v", namespace, err)
+		e.skipped = append(e.skipped, namespace)
+		e.forbiddenErr = err
+		return nil
+	}
+	if e.partial {
+		logrus.Debugf("leaving out failed namespace %s: %v", namespace, err)
+		e.failed = append(e.failed, namespaceError{namespace: namespace, err: err})
+		return nil
+	}
+	return err
+}
+
+// merge adds the namespaces left out by another request.
+func (e *namespaceErrors) merge(other *namespaceErrors) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.skipped = append(e.skipped, other.skipped...)
+	e.failed = append(e.failed, other.failed...)
+	if other.forbiddenErr != nil {
+		e.forbiddenErr = other.forbiddenErr
+	}
+}
+
+// err returns the error to fail the request with if none of the queried namespaces could be read.
+func (e *namespaceErrors) err(queried int) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if queried > 0 && len(e.skipped) == queried {
+		return e.forbiddenErr
+	}
+	if len(e.failed) > 0 && len(e.failed)+len(e.skipped) == queried {
+		return e.failed[0].err
+	}
+	return nil
+}
+
+// skippedNamespaces returns the skipped namespaces, sorted by name and without duplicates.
+func (e *namespaceErrors) skippedNamespaces() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	skipped := make([]string, 0, len(e.skipped))
+	seen := make(map[string]bool, len(e.skipped))
+	for _, ns := range e.skipped {
+		if !seen[ns] {
+			seen[ns] = true
+			skipped = append(skipped, ns)
+		}
+	}
+	sort.Strings(skipped)
+	return skipped
+}
+
+// failedNamespaces returns the failed namespaces for the list metadata, sorted by name.
+func (e *namespaceErrors) failedNamespaces() []failedNamespace {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	result := make([]failedNamespace, 0, len(e.failed))
+	for _, nsErr := range e.failed {
+		result = append(result, failedNamespace{Namespace: nsErr.namespace, Error: nsErr.err.Error()})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result
+}
+
+// addMeta adds the namespaces that were left out to the list metadata.
+func (e *namespaceErrors) addMeta(meta map[string]interface{}) {
+	if skipped := e.skippedNamespaces(); len(skipped) > 0 {
+		meta[skippedNamespacesKey] = skipped
+	}
+	if failed := e.failedNamespaces(); len(failed) > 0 {
+		meta[failedNamespacesKey] = failed
+	}
+}
+
+// addWarnings adds a Warning header for every namespace that was left out.
+func (e *namespaceErrors) addWarnings(w http.ResponseWriter) {
+	for _, ns := range e.skippedNamespaces() {
+		addWarning(w, fmt.Sprintf("skipped namespace %s: access forbidden", ns))
+	}
+	for _, nsErr := range e.failedNamespaces() {
+		addWarning(w, fmt.Sprintf("failed namespace %s: %s", nsErr.Namespace, nsErr.Error))
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestNamespaceErrors(t *testing.T) {
+	forbidden := apierrors.NewForbidden(secretsResource.GroupResource(), "", errors.New("not allowed"))
+	failure := errors.New("failed")
+	tests := []struct {
+		name    string
+		partial bool
+		errs    map[string]error
+		queried int
+		// wantFailed is whether adding the errors fails the request
+		wantFailed  bool
+		wantErr     error
+		wantSkipped []string
+	}{
+		{
+			name:        "some namespaces forbidden",
+			errs:        map[string]error{"b": forbidden, "a": forbidden},
+			queried:     3,
+			wantSkipped: []string{"a", "b"},
+		},
+		{
+			name:        "every namespace forbidden",
+			errs:        map[string]error{"a": forbidden, "b": forbidden},
+			queried:     2,
+			wantErr:     forbidden,
+			wantSkipped: []string{"a", "b"},
+		},
+		{
+			name:       "failure",
+			errs:       map[string]error{"a": failure},
+			queried:    2,
+			wantFailed: true,
+		},
+		{
+			name:    "partial failure",
+			partial: true,
+			errs:    map[string]error{"a": failure},
+			queried: 2,
+		},
+		{
+			name:        "every namespace forbidden or failed",
+			partial:     true,
+			errs:        map[string]error{"a": failure, "b": forbidden},
+			queried:     2,
+			wantErr:     failure,
+			wantSkipped: []string{"b"},
+		},
+		{
+			name:    "no namespaces",
+			queried: 0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs := newNamespaceErrors(test.partial)
+			failed := false
+			for ns, err := range test.errs {
+				if errs.add(ns, err) != nil {
+					failed = true
+				}
+			}
+			if failed != test.wantFailed {
+				t.Errorf("got failed %t, want %t", failed, test.wantFailed)
+			}
+			if err := errs.err(test.queried); err != test.wantErr {
+				t.Errorf("got error %v, want %v", err, test.wantErr)
+			}
+			if got := errs.skippedNamespaces(); len(got) > 0 || len(test.wantSkipped) > 0 {
+				if !reflect.DeepEqual(got, test.wantSkipped) {
+					t.Errorf("got skipped %v, want %v", got, test.wantSkipped)
+				}
+			}
+			w := httptest.NewRecorder()
+			errs.addWarnings(w)
+			if got, want := len(w.Header().Values("Warning")), len(test.wantSkipped)+len(errs.failedNamespaces()); got != want {
+				t.Errorf("got %d warnings, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestNamespaceErrorsMerge(t *testing.T) {
+	forbidden := apierrors.NewForbidden(secretsResource.GroupResource(), "", errors.New("not allowed"))
+	errs := newNamespaceErrors(true)
+	for _, ns := range []string{"b", "a"} {
+		other := newNamespaceErrors(true)
+		other.add(ns, forbidden)
+		other.add("c", forbidden)
+		other.add("d", errors.New("failed"))
+		errs.merge(other)
+	}
+	if got, want := errs.skippedNamespaces(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got skipped %v, want %v", got, want)
+	}
+	meta := listMeta("1", "", errs)
+	if failed, _ := meta[failedNamespacesKey].([]failedNamespace); len(failed) != 2 {
+		t.Errorf("got failed namespaces %v, want d from each request", meta[failedNamespacesKey])
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/endpoints/handlers/negotiation"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+// protobufWatchContentType is the content type of a length-delimited protobuf watch stream.
+const protobufWatchContentType = runtime.ContentTypeProtobuf + ";stream=watch"
+
+var protobufSerializer = protobuf.NewSerializer(scheme.Scheme, scheme.Scheme)
+
+// protobufSupported returns whether the kind of the resource is known to the client-go scheme.
+func protobufSupported(resource schema.GroupVersionResource, apis apiresources.APIResourceWatcher) bool {
+	kind := apis.GetKindForResource(resource)
+	return kind != "" && scheme.Scheme.Recognizes(resource.GroupVersion().WithKind(kind))
+}
+
+// negotiate picks the media type of the response from the request's Accept header.
+func negotiate(r *http.Request, allowProtobuf bool) (negotiation.MediaTypeOptions, bool) {
+	acceptedTypes := []runtime.SerializerInfo{
+		{
+			MediaType:        runtime.ContentTypeJSON,
+			MediaTypeType:    "application",
+			MediaTypeSubType: "json",
+		},
+	}
+	if allowProtobuf {
+		acceptedTypes = append(acceptedTypes, runtime.SerializerInfo{
+			MediaType:        runtime.ContentTypeProtobuf,
+			MediaTypeType:    "application",
+			MediaTypeSubType: "vnd.kubernetes.protobuf",
+		})
+	}
+	return negotiation.NegotiateMediaTypeOptions(r.Header.Get("Accept"), acceptedTypes, endpointRestrictions{})
+}
+
+// outputProtobuf returns whether the response for the resource is encoded as protobuf.
+func outputProtobuf(r *http.Request, resource schema.GroupVersionResource, apis apiresources.APIResourceWatcher) bool {
+	mediaType, ok := negotiate(r, protobufSupported(resource, apis))
+	return ok && mediaType.Accepted.MediaType == runtime.ContentTypeProtobuf
+}
+
+// toTyped converts a JSON object from the Kubernetes API server to its typed form.
+func toTyped(obj interface{}) (runtime.Object, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.Decode(scheme.Codecs.UniversalDeserializer(), data)
+}
+
+// writeObject writes an object or list of the resource as protobuf if the client asked for it, or as JSON otherwise.
+func writeObject(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, apis apiresources.APIResourceWatcher, obj interface{}) {
+	if !outputProtobuf(r, resource, apis) {
+		w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+		returnResp(w, obj)
+		return
+	}
+	typed, err := toTyped(obj)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", runtime.ContentTypeProtobuf)
+	if err := protobufSerializer.Encode(typed, w); err != nil {
+		logrus.Errorf("could not encode response as protobuf: %v", err)
+	}
+}
+
+// watchEncoder writes a single watch event to the client.
+type watchEncoder func(w io.Writer, event watch.Event) error
+
+// jsonWatchEncoder writes each event as a JSON object on its own line.
+func jsonWatchEncoder(w io.Writer, event watch.Event) error {
+	outEvent, err := convertEvent(event)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(outEvent)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// protobufWatchEncoder writes each event as a length-delimited protobuf WatchEvent.
+func protobufWatchEncoder(w io.Writer) watchEncoder {
+	frameWriter := protobuf.LengthDelimitedFramer.NewFrameWriter(w)
+	return func(_ io.Writer, event watch.Event) error {
+		typed, err := toTyped(event.Object)
+		if err != nil {
+			return err
+		}
+		obj, err := runtime.Encode(protobufSerializer, typed)
+		if err != nil {
+			return err
+		}
+		outEvent := &metav1.WatchEvent{
+			Type:   string(event.Type),
+			Object: runtime.RawExtension{Raw: obj},
+		}
+		data, err := outEvent.Marshal()
+		if err != nil {
+			return err
+		}
+		_, err = frameWriter.Write(data)
+		return err
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	tableAccept          = "application/json;as=Table;v=v1;g=meta.k8s.io"
+	protobufTableAccept  = "application/vnd.kubernetes.protobuf;as=Table;v=v1;g=meta.k8s.io"
+	protobufAcceptHeader = runtime.ContentTypeProtobuf + ", " + runtime.ContentTypeJSON
+)
+
+var (
+	widgetsResource = schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	// newerResource is in a group version known to the client-go scheme, but its kind is not
+	newerResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "widgets"}
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		resource schema.GroupVersionResource
+		// want is the negotiated media type, empty if negotiation fails
+		want string
+	}{
+		{
+			name:     "protobuf for a built-in resource",
+			accept:   protobufAcceptHeader,
+			resource: secretsResource,
+			want:     runtime.ContentTypeProtobuf,
+		},
+		{
+			name:     "JSON for a custom resource",
+			accept:   protobufAcceptHeader,
+			resource: widgetsResource,
+			want:     runtime.ContentTypeJSON,
+		},
+		{
+			name:     "JSON for a kind newer than the scheme",
+			accept:   protobufAcceptHeader,
+			resource: newerResource,
+			want:     runtime.ContentTypeJSON,
+		},
+		{
+			name:     "only protobuf for a custom resource",
+			accept:   runtime.ContentTypeProtobuf,
+			resource: widgetsResource,
+		},
+		{
+			name:     "Tables are only JSON",
+			accept:   protobufTableAccept + ", " + tableAccept,
+			resource: secretsResource,
+			want:     runtime.ContentTypeJSON,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", test.accept)
+			mediaType, ok := negotiate(r, protobufSupported(test.resource, fakeAPIs{}))
+			got := ""
+			if ok {
+				got = mediaType.Accepted.MediaType
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if want := test.want == runtime.ContentTypeProtobuf; outputProtobuf(r, test.resource, fakeAPIs{}) != want {
+				t.Errorf("expected protobuf output to be %t", want)
+			}
+		})
+	}
+}
+
+func TestListProtobuf(t *testing.T) {
+	namespaces := testNamespaceCache(
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+	)
+	client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s2"}}}
+	handler := NamespaceHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, namespaces, nil, nil)
+	r := testRequest("/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets", map[string]string{"namespace": "a", "resource": "secrets"})
+	r.Header.Set("Accept", protobufAcceptHeader)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); got != runtime.ContentTypeProtobuf {
+		t.Errorf("got content type %q, want %q", got, runtime.ContentTypeProtobuf)
+	}
+	obj, _, err := protobufSerializer.Decode(w.Body.Bytes(), nil, nil)
+	if err != nil {
+		t.Fatalf("invalid protobuf response: %v", err)
+	}
+	list, ok := obj.(*corev1.SecretList)
+	if !ok {
+		t.Fatalf("got %T, want a SecretList", obj)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, secret := range list.Items {
+		names = append(names, secret.Namespace+"/"+secret.Name)
+	}
+	if want := []string{"a/s1", "b/s2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	if list.ResourceVersion != "100" {
+		t.Errorf("got resource version %q, want 100", list.ResourceVersion)
+	}
+}
+
+func TestWatchProtobuf(t *testing.T) {
+	watcher := watch.NewFake()
+	r := httptest.NewRequest(http.MethodGet, "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets?watch=true", nil)
+	r.Header.Set("Accept", protobufAcceptHeader)
+	w := newStreamRecorder()
+	done := make(chan struct{})
+	go func() {
+		watchHandler(w, r, secretsResource, fakeAPIs{}, []watch.Interface{watcher}, nil, nil)
+		close(done)
+	}()
+
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	secret.SetAPIVersion("v1")
+	secret.SetKind("Secret")
+	secret.SetNamespace("a")
+	secret.SetName("s1")
+	watcher.Add(secret)
+	// the frame is written as its length and then the event
+	frame := append(<-w.writes, <-w.writes...)
+	watcher.Stop()
+	<-done
+
+	if got := w.Header().Get("Content-Type"); got != protobufWatchContentType {
+		t.Errorf("got content type %q, want %q", got, protobufWatchContentType)
+	}
+	reader := protobuf.LengthDelimitedFramer.NewFrameReader(readCloser{bytes.NewReader(frame)})
+	data := make([]byte, len(frame))
+	n, err := reader.Read(data)
+	if err != nil {
+		t.Fatalf("invalid frame: %v", err)
+	}
+	event := metav1.WatchEvent{}
+	if err := event.Unmarshal(data[:n]); err != nil {
+		t.Fatalf("invalid watch event: %v", err)
+	}
+	if event.Type != string(watch.Added) {
+		t.Errorf("got a %s event, want %s", event.Type, watch.Added)
+	}
+	obj, _, err := protobufSerializer.Decode(event.Object.Raw, nil, nil)
+	if err != nil {
+		t.Fatalf("invalid protobuf object: %v", err)
+	}
+	if got, ok := obj.(*corev1.Secret); !ok || got.Namespace != "a" || got.Name != "s1" {
+		t.Errorf("got %#v, want the secret a/s1", obj)
+	}
+}
+
+type readCloser struct {
+	*bytes.Reader
+}
+
+func (readCloser) Close() error {
+	return nil
+}
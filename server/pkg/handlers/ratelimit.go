@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"github.com/gorilla/mux"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// RateLimitMiddleware rejects requests when the user or the server has too many requests in flight.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := mux.Vars(r)["resource"]; !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			user, ok := request.UserFrom(r.Context())
+			if !ok {
+				http.Error(w, errNoUser.Error(), http.StatusUnauthorized)
+				return
+			}
+			ctx := limiter.WithUser(r.Context(), user.GetName())
+			if requestVerb(r) == "watch" {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			release, err := limiter.Acquire(user.GetName())
+			if isErrorAndHandleError(w, err) {
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
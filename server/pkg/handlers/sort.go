@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corecache "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+const (
+	sortByParam = "sortBy"
+	// sortByNamespace sorts by namespace name and then object name. This is the default.
+	sortByNamespace = "namespace"
+	// sortByTree puts every namespace before its descendants.
+	sortByTree = "tree"
+	// sortByCreationTimestamp sorts oldest first.
+	sortByCreationTimestamp = "creationTimestamp"
+)
+
+// objectLess reports whether the object a sorts before the object b.
+type objectLess func(a, b *unstructured.Unstructured) bool
+
+// treePaths returns the path from the root of the hierarchy to the namespace, including the namespace itself.
+type treePaths func(namespace string) []string
+
+// sorter returns the ordering requested by the sortBy query parameter.
+func sorter(sortBy string, paths treePaths) (objectLess, error) {
+	switch sortBy {
+	case "", sortByNamespace:
+		return byNamespace, nil
+	case sortByTree:
+		return byTree(paths), nil
+	case sortByCreationTimestamp:
+		return byCreationTimestamp, nil
+	}
+	return byJSONPath(sortBy)
+}
+
+func byNamespace(a, b *unstructured.Unstructured) bool {
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+	return a.GetName() < b.GetName()
+}
+
+func byTree(paths treePaths) objectLess {
+	return func(a, b *unstructured.Unstructured) bool {
+		if a.GetNamespace() == b.GetNamespace() {
+			return a.GetName() < b.GetName()
+		}
+		pathA := paths(a.GetNamespace())
+		pathB := paths(b.GetNamespace())
+		for i := 0; i < len(pathA) && i < len(pathB); i++ {
+			if pathA[i] != pathB[i] {
+				return pathA[i] < pathB[i]
+			}
+		}
+		if len(pathA) != len(pathB) {
+			return len(pathA) < len(pathB)
+		}
+		return byNamespace(a, b)
+	}
+}
+
+func byCreationTimestamp(a, b *unstructured.Unstructured) bool {
+	timeA := a.GetCreationTimestamp()
+	timeB := b.GetCreationTimestamp()
+	if !timeA.Equal(&timeB) {
+		return timeA.Before(&timeB)
+	}
+	return byNamespace(a, b)
+}
+
+func byJSONPath(expression string) (objectLess, error) {
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+	parser := jsonpath.New(sortByParam).AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid %s value %q: %v", sortByParam, expression, err))
+	}
+	value := func(obj *unstructured.Unstructured) interface{} {
+		results, err := parser.FindResults(obj.Object)
+		if err != nil || len(results) == 0 || len(results[0]) == 0 {
+			return nil
+		}
+		v := results[0][0]
+		if v.Kind() == reflect.Interface && !v.IsNil() {
+			v = v.Elem()
+		}
+		if !v.IsValid() || !v.CanInterface() {
+			return nil
+		}
+		return v.Interface()
+	}
+	return func(a, b *unstructured.Unstructured) bool {
+		valueA := value(a)
+		valueB := value(b)
+		if reflect.DeepEqual(valueA, valueB) {
+			return byNamespace(a, b)
+		}
+		return lessValue(valueA, valueB)
+	}, nil
+}
+
+// lessValue compares two JSON values, with missing values first.
+func lessValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	numberA, okA := toFloat(a)
+	numberB, okB := toFloat(b)
+	if okA && okB {
+		return numberA < numberB
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func sortItems(items []unstructured.Unstructured, less objectLess) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return less(&items[i], &items[j])
+	})
+}
+
+func sortRows(rows []interface{}, less objectLess) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return less(rowObject(rows[i]), rowObject(rows[j]))
+	})
+}
+
+// rowObject returns the object embedded in a Table row.
+func rowObject(row interface{}) *unstructured.Unstructured {
+	rowMap, _ := row.(map[string]interface{})
+	obj, _ := rowMap["object"].(map[string]interface{})
+	return &unstructured.Unstructured{Object: obj}
+}
+
+// namespaceTreePaths returns the ancestors of each namespace from its HNC depth labels.
+func namespaceTreePaths(namespaces []*corev1.Namespace) treePaths {
+	paths := make(map[string][]string, len(namespaces))
+	for _, ns := range namespaces {
+		paths[ns.Name] = treePath(ns)
+	}
+	return func(namespace string) []string {
+		if path, ok := paths[namespace]; ok {
+			return path
+		}
+		return []string{namespace}
+	}
+}
+
+// cachedTreePaths returns the tree paths of namespaces as they are needed from the namespace cache.
+func cachedTreePaths(namespaceCache corecache.NamespaceLister) treePaths {
+	paths := make(map[string][]string)
+	return func(namespace string) []string {
+		if path, ok := paths[namespace]; ok {
+			return path
+		}
+		path := []string{namespace}
+		if ns, err := namespaceCache.Get(namespace); err == nil {
+			path = treePath(ns)
+		}
+		paths[namespace] = path
+		return path
+	}
+}
+
+func treePath(ns *corev1.Namespace) []string {
+	depths := make(map[string]int)
+	for label, value := range ns.Labels {
+		if !strings.HasSuffix(label, hnsLabelSuffix) {
+			continue
+		}
+		depth := 0
+		if _, err := fmt.Sscanf(value, "%d", &depth); err != nil {
+			continue
+		}
+		depths[strings.TrimSuffix(label, hnsLabelSuffix)] = depth
+	}
+	if len(depths) == 0 {
+		return []string{ns.Name}
+	}
+	path := make([]string, 0, len(depths))
+	for ancestor := range depths {
+		path = append(path, ancestor)
+	}
+	sort.Slice(path, func(i, j int) bool {
+		return depths[path[i]] > depths[path[j]]
+	})
+	return path
+}
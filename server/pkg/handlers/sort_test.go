@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cmurphy/hns-list/pkg/redaction"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// hncNamespace returns a namespace with the HNC depth labels for the given ancestors, where the value is the depth
+// of the namespace below the ancestor.
+func hncNamespace(name string, depths map[string]string) *corev1.Namespace {
+	labels := make(map[string]string, len(depths))
+	for ancestor, depth := range depths {
+		labels[ancestor+hnsLabelSuffix] = depth
+	}
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func namespacedObject(namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestTreePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		namespace *corev1.Namespace
+		want      []string
+	}{
+		{
+			name:      "root",
+			namespace: hncNamespace("root", map[string]string{"root": "0"}),
+			want:      []string{"root"},
+		},
+		{
+			name:      "grandchild",
+			namespace: hncNamespace("grandchild", map[string]string{"grandchild": "0", "child": "1", "root": "2"}),
+			want:      []string{"root", "child", "grandchild"},
+		},
+		{
+			name:      "no labels",
+			namespace: hncNamespace("plain", nil),
+			want:      []string{"plain"},
+		},
+		{
+			name:      "missing parent label",
+			namespace: hncNamespace("grandchild", map[string]string{"grandchild": "0", "root": "2"}),
+			want:      []string{"root", "grandchild"},
+		},
+		{
+			name:      "invalid depth",
+			namespace: hncNamespace("child", map[string]string{"child": "0", "root": "one"}),
+			want:      []string{"child"},
+		},
+		{
+			name: "other labels",
+			namespace: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "child", Labels: map[string]string{
+				"child" + hnsLabelSuffix: "0",
+				"root" + hnsLabelSuffix:  "1",
+				"team":                   "a",
+			}}},
+			want: []string{"root", "child"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := treePath(test.namespace); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestByTree(t *testing.T) {
+	namespaces := []*corev1.Namespace{
+		hncNamespace("root", map[string]string{"root": "0"}),
+		hncNamespace("b-child", map[string]string{"b-child": "0", "root": "1"}),
+		hncNamespace("a-child", map[string]string{"a-child": "0", "root": "1"}),
+		hncNamespace("a-grandchild", map[string]string{"a-grandchild": "0", "b-child": "1", "root": "2"}),
+		hncNamespace("z-grandchild", map[string]string{"z-grandchild": "0", "a-child": "1", "root": "2"}),
+		// the label for the parent is missing, so the namespace sorts as a direct child of the root
+		hncNamespace("orphan", map[string]string{"orphan": "0", "root": "2"}),
+		hncNamespace("other-root", map[string]string{"other-root": "0"}),
+	}
+	objects := []*unstructured.Unstructured{
+		namespacedObject("z-grandchild", "s1"),
+		namespacedObject("orphan", "s1"),
+		namespacedObject("b-child", "s2"),
+		namespacedObject("root", "s1"),
+		namespacedObject("a-grandchild", "s1"),
+		namespacedObject("b-child", "s1"),
+		namespacedObject("other-root", "s1"),
+		namespacedObject("unknown", "s1"),
+		namespacedObject("a-child", "s1"),
+	}
+	less, err := sorter(sortByTree, namespaceTreePaths(namespaces))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		return less(objects[i], objects[j])
+	})
+	got := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		got = append(got, obj.GetNamespace()+"/"+obj.GetName())
+	}
+	want := []string{
+		"other-root/s1",
+		"root/s1",
+		// siblings at the same depth are sorted by name, each followed by its own subtree
+		"a-child/s1",
+		"z-grandchild/s1",
+		"b-child/s1",
+		"b-child/s2",
+		"a-grandchild/s1",
+		"orphan/s1",
+		// namespaces that are not in the tree are their own root
+		"unknown/s1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSorterInvalid(t *testing.T) {
+	if _, err := sorter("{.metadata.labels[", nil); !apierrors.IsBadRequest(err) {
+		t.Errorf("expected a bad request error, got %v", err)
+	}
+}
+
+func TestSortByRedactedField(t *testing.T) {
+	redactor, err := redaction.New(redaction.Config{Rules: []redaction.Rule{
+		{Resource: "secrets", Paths: []string{"data.password"}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	namespaces := testNamespaceCache(
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+	)
+	tests := []struct {
+		name    string
+		handler func(clientGetter) http.HandlerFunc
+		path    string
+		vars    map[string]string
+	}{
+		{
+			name: "cluster-wide",
+			handler: func(clients clientGetter) http.HandlerFunc {
+				return Forwarder(clients, fakeAPIs{}, namespaces, nil, redactor)
+			},
+			path: "/apis/resources.hns.demo/v1alpha1/secrets",
+			vars: map[string]string{"resource": "secrets"},
+		},
+		{
+			name: "subtree",
+			handler: func(clients clientGetter) http.HandlerFunc {
+				return NamespaceHandler(clients, fakeAPIs{}, namespaces, nil, redactor)
+			},
+			path: "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets",
+			vars: map[string]string{"namespace": "a", "resource": "secrets"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeClient{
+				objects: map[string][]string{"a": {"s1", "s2"}, "b": {"s3"}},
+				// sorted by password, the order would be a/s2, b/s3, a/s1
+				data: map[string]map[string]interface{}{
+					"a/s1": {"password": "z"},
+					"a/s2": {"password": "a"},
+					"b/s3": {"password": "m"},
+				},
+			}
+			w := httptest.NewRecorder()
+			handler := test.handler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}))
+			handler(w, testRequest(test.path+"?sortBy={.data.password}", test.vars))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			page := testPage{}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+			}
+			// every password is masked, so the objects keep the default order
+			if want := []string{"a/s1", "a/s2", "b/s3"}; !reflect.DeepEqual(page.names(), want) {
+				t.Errorf("got %v, want %v", page.names(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/cmurphy/hns-list/pkg/apiresources"
+	"github.com/cmurphy/hns-list/pkg/audit"
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"github.com/cmurphy/hns-list/pkg/redaction"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/semaphore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const streamParam = "stream"
+
+// namespaceOutcome is the list returned by a single namespace, or the error it failed with.
+type namespaceOutcome struct {
+	namespace string
+	list      *unstructured.UnstructuredList
+	err       error
+}
+
+// listStream writes a merged list to the client one namespace at a time.
+type listStream struct {
+	w         http.ResponseWriter
+	r         *http.Request
+	resource  schema.GroupVersionResource
+	apis      apiresources.APIResourceWatcher
+	redactor  *redaction.Redactor
+	less      objectLess
+	hierarchy hierarchyLookup
+
+	started bool
+	table   bool
+	// columns are the column definitions of the first namespace, which every other must match.
+	columns     []interface{}
+	columnIndex map[string]int
+	written     int
+}
+
+// streamListHandler writes the items of each namespace as soon as they arrive.
+func streamListHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions, apis apiresources.APIResourceWatcher, redactor *redaction.Redactor, less objectLess) {
+	sortBy := r.URL.Query().Get(sortByParam)
+	ordered := sortBy == sortByNamespace || sortBy == sortByTree
+	if sortBy != "" && !ordered {
+		isErrorAndHandleError(w, apierrors.NewBadRequest("streamed lists can only be sorted by namespace or tree"))
+		return
+	}
+	if consistent, _ := strconv.ParseBool(r.URL.Query().Get(consistentParam)); consistent {
+		isErrorAndHandleError(w, apierrors.NewBadRequest("streamed lists can not be consistent"))
+		return
+	}
+	order := make([]*corev1.Namespace, len(namespaces))
+	copy(order, namespaces)
+	if ordered {
+		sort.SliceStable(order, func(i, j int) bool {
+			return less(namespaceObject(order[i].Name), namespaceObject(order[j].Name))
+		})
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	outcomes := make(chan namespaceOutcome)
+	go func() {
+		sem := semaphore.NewWeighted(ratelimit.NamespaceWorkers(ctx))
+		wg := sync.WaitGroup{}
+		for _, ns := range order {
+			ns := ns.Name
+			if err := sem.Acquire(ctx, 1); err != nil {
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer sem.Release(1)
+				list, err := client.Namespace(ns).List(ctx, opts)
+				outcomes <- namespaceOutcome{namespace: ns, list: list, err: err}
+			}()
+		}
+		wg.Wait()
+		close(outcomes)
+	}()
+	defer func() {
+		// stop the lists that are still running and let them finish
+		cancel()
+		for range outcomes {
+		}
+	}()
+
+	stream := &listStream{
+		w:         w,
+		r:         r,
+		resource:  resource,
+		apis:      apis,
+		redactor:  redactor,
+		less:      less,
+		hierarchy: namespaceHierarchies(r, namespaces),
+	}
+	errs := newNamespaceErrors(partialResults(r))
+	latestResourceVersion := 0
+	// handle returns false if the namespace failed and the response can't continue.
+	handle := func(outcome namespaceOutcome) bool {
+		if outcome.err != nil {
+			err := errs.add(outcome.namespace, outcome.err)
+			if err == nil {
+				return true
+			}
+			if stream.started {
+				logrus.Errorf("aborting streamed list, namespace %s failed: %v", outcome.namespace, err)
+				panic(http.ErrAbortHandler)
+			}
+			isErrorAndHandleError(w, err)
+			return false
+		}
+		if rv, err := strconv.Atoi(outcome.list.GetResourceVersion()); err == nil && rv > latestResourceVersion {
+			latestResourceVersion = rv
+		}
+		if !stream.started {
+			// skipped and failed namespaces are only reported in the headers if they were seen before the first write
+			errs.addWarnings(w)
+			stream.start(outcome.list)
+		}
+		stream.write(outcome.namespace, outcome.list)
+		return true
+	}
+
+	pending := make(map[string]namespaceOutcome)
+	next := 0
+	for outcome := range outcomes {
+		if !ordered {
+			if !handle(outcome) {
+				return
+			}
+			continue
+		}
+		pending[outcome.namespace] = outcome
+		for ; next < len(order); next++ {
+			outcome, ok := pending[order[next].Name]
+			if !ok {
+				break
+			}
+			delete(pending, order[next].Name)
+			if !handle(outcome) {
+				return
+			}
+		}
+	}
+
+	if !stream.started && isErrorAndHandleError(w, errs.err(len(namespaces))) {
+		return
+	}
+	resourceVersion := strconv.Itoa(latestResourceVersion)
+	if resourceVersion == "0" {
+		var err error
+		resourceVersion, err = emptyResourceVersion(r.Context(), resource, client)
+		if err != nil {
+			logrus.Debugf("could not get resource version for streamed list: %v", err)
+			resourceVersion = "0"
+		}
+	}
+	if !stream.started {
+		writeList(w, r, resource, apis, listMeta(resourceVersion, "", errs), nil, []unstructured.Unstructured{}, nil)
+		return
+	}
+	stream.finish(listMeta(resourceVersion, "", errs))
+}
+
+// namespaceObject returns an empty object in the namespace, to order namespaces with an objectLess.
+func namespaceObject(namespace string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	obj.SetNamespace(namespace)
+	return obj
+}
+
+// start writes the beginning of the list, which is a Table if the first namespace returned one.
+func (s *listStream) start(list *unstructured.UnstructuredList) {
+	s.started = true
+	if columns, ok := list.Object["columnDefinitions"].([]interface{}); ok {
+		s.table = true
+		s.columns = addHierarchy(s.hierarchy, columns, nil, nil)
+		s.columnIndex = make(map[string]int, len(s.columns))
+		for i, column := range s.columns {
+			s.columnIndex[columnName(column)] = i
+		}
+	}
+	s.w.Header().Set("Content-Type", "application/json")
+	if s.table {
+		s.w.Write([]byte(`{"apiVersion":"meta.k8s.io/v1","kind":"Table","rows":[`))
+		return
+	}
+	s.w.Write([]byte(`{"apiVersion":` + strconv.Quote(s.resource.GroupVersion().String()) + `,"kind":` + strconv.Quote(s.apis.GetKindForResource(s.resource)+"List") + `,"items":[`))
+}
+
+// write writes the objects or rows of one namespace and flushes them to the client.
+func (s *listStream) write(namespace string, list *unstructured.UnstructuredList) {
+	columns, items, rows := mergeLists([]namespaceList{{namespace: namespace, list: list}})
+	for i := range items {
+		s.redactor.Redact(s.r.Context(), s.resource, items[i].Object)
+	}
+	s.redactor.RedactRows(s.r.Context(), s.resource, rows)
+	sortItems(items, s.less)
+	sortRows(rows, s.less)
+	columns = addHierarchy(s.hierarchy, columns, items, rows)
+
+	entries := make([]interface{}, 0, len(items)+len(rows))
+	if s.table {
+		if columns != nil && !sameColumns(columns, s.columns) {
+			if !sameColumnSet(columns, s.columnIndex) {
+				logrus.Errorf("aborting streamed list, namespace %s returned different table columns", namespace)
+				panic(http.ErrAbortHandler)
+			}
+			rearrangeCells(rows, columns, s.columnIndex, len(s.columns))
+		}
+		stripRowObjects(s.r, rows)
+		entries = append(entries, rows...)
+	} else {
+		for _, item := range items {
+			entries = append(entries, item.Object)
+		}
+	}
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			logrus.Errorf("aborting streamed list, could not encode object: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+		if s.written > 0 {
+			s.w.Write([]byte(","))
+		}
+		s.w.Write(data)
+		s.written++
+	}
+	audit.AddItemsReturned(s.r.Context(), len(entries))
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// sameColumnSet returns whether the columns are the indexed columns, in any order.
+func sameColumnSet(columns []interface{}, columnIndex map[string]int) bool {
+	if len(columns) != len(columnIndex) {
+		return false
+	}
+	for _, column := range columns {
+		if _, ok := columnIndex[columnName(column)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// finish writes the end of the list, with the column definitions of a Table and the list metadata.
+func (s *listStream) finish(meta map[string]interface{}) {
+	s.w.Write([]byte("]"))
+	if s.table {
+		columns, _ := json.Marshal(s.columns)
+		s.w.Write([]byte(`,"columnDefinitions":`))
+		s.w.Write(columns)
+	}
+	metaJSON, _ := json.Marshal(meta)
+	s.w.Write([]byte(`,"metadata":`))
+	s.w.Write(metaJSON)
+	s.w.Write([]byte("}\n"))
+}
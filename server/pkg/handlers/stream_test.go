@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func streamTable(t *testing.T, client *fakeClient, namespaces ...string) (*httptest.ResponseRecorder, interface{}) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets?stream=true&sortBy=namespace", nil)
+	w := httptest.NewRecorder()
+	var aborted interface{}
+	func() {
+		defer func() {
+			aborted = recover()
+		}()
+		streamListHandler(w, r, secretsResource, client, testNamespaces(namespaces...), metav1.ListOptions{}, fakeAPIs{}, nil, byNamespace)
+	}()
+	return w, aborted
+}
+
+func TestStreamTableColumnOrder(t *testing.T) {
+	client := &fakeClient{
+		objects: map[string][]string{"a": {"s1"}, "b": {"s1"}},
+		columns: map[string][]string{"a": {"Name", "Age"}, "b": {"Age", "Name"}},
+	}
+	w, aborted := streamTable(t, client, "a", "b")
+	if aborted != nil {
+		t.Fatalf("unexpected abort: %v", aborted)
+	}
+	table := struct {
+		ColumnDefinitions []metav1.TableColumnDefinition `json:"columnDefinitions"`
+		Rows              []metav1.TableRow              `json:"rows"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &table); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	columns := make([]string, 0, len(table.ColumnDefinitions))
+	for _, column := range table.ColumnDefinitions {
+		columns = append(columns, column.Name)
+	}
+	if want := []string{"Name", "Age"}; !reflect.DeepEqual(columns, want) {
+		t.Errorf("got columns %v, want %v", columns, want)
+	}
+	if len(table.Rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(table.Rows))
+	}
+	for _, row := range table.Rows {
+		if want := []interface{}{"Name", "Age"}; !reflect.DeepEqual(row.Cells, want) {
+			t.Errorf("got cells %v, want %v", row.Cells, want)
+		}
+	}
+}
+
+func TestStreamTableDifferentColumns(t *testing.T) {
+	client := &fakeClient{
+		objects: map[string][]string{"a": {"s1"}, "b": {"s1"}},
+		columns: map[string][]string{"a": {"Name", "Age"}, "b": {"Name", "Type", "Age"}},
+	}
+	w, aborted := streamTable(t, client, "a", "b")
+	if aborted != http.ErrAbortHandler {
+		t.Fatalf("expected the response to be aborted, got %v", aborted)
+	}
+	if json.Valid(w.Body.Bytes()) {
+		t.Errorf("expected an incomplete response, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	corecache "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	rootParam          = "root"
+	minDepthParam      = "minDepth"
+	maxDepthParam      = "maxDepth"
+	childrenOnlyParam  = "childrenOnly"
+	excludeParentParam = "excludeParent"
+	// namespaceSelectorParam is a label selector on the namespaces themselves.
+	namespaceSelectorParam = "namespaceSelector"
+)
+
+// subtreeRoots returns the parent namespaces from the path and the root query parameters.
+func subtreeRoots(r *http.Request) []string {
+	namespace, ok := mux.Vars(r)["namespace"]
+	if !ok {
+		return nil
+	}
+	roots := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, root := range append(strings.Split(namespace, ","), r.URL.Query()[rootParam]...) {
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// subtreeNamespaces returns the union of the subtrees of the parent namespaces, sorted by name.
+func subtreeNamespaces(namespaceCache corecache.NamespaceLister, roots []string, query url.Values) ([]*corev1.Namespace, error) {
+	nsSelector, err := namespaceSelector(query)
+	if err != nil {
+		return nil, err
+	}
+	requirements, _ := nsSelector.Requirements()
+	byName := make(map[string]*corev1.Namespace)
+	for _, root := range roots {
+		selector, err := subtreeSelector(root, query)
+		if err != nil {
+			return nil, err
+		}
+		selector = selector.Add(requirements...)
+		namespaces, err := namespaceCache.List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range namespaces {
+			byName[ns.Name] = ns
+		}
+	}
+	namespaces := make([]*corev1.Namespace, 0, len(byName))
+	for _, ns := range byName {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+	return namespaces, nil
+}
+
+// subtreeSelector returns a label selector for the namespaces under the parent within the requested depth.
+func subtreeSelector(parent string, query url.Values) (labels.Selector, error) {
+	label := parent + hnsLabelSuffix
+	minDepth, err := depthParam(query, minDepthParam, 0)
+	if err != nil {
+		return nil, err
+	}
+	maxDepth, err := depthParam(query, maxDepthParam, -1)
+	if err != nil {
+		return nil, err
+	}
+	if childrenOnly, _ := strconv.ParseBool(query.Get(childrenOnlyParam)); childrenOnly {
+		minDepth, maxDepth = 1, 1
+	}
+	if excludeParent, _ := strconv.ParseBool(query.Get(excludeParentParam)); excludeParent && minDepth < 1 {
+		minDepth = 1
+	}
+	if maxDepth >= 0 && maxDepth < minDepth {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s must not be less than %s", maxDepthParam, minDepthParam))
+	}
+
+	exists, err := labels.NewRequirement(label, selection.Exists, nil)
+	if err != nil {
+		return nil, invalidRootError(parent, err)
+	}
+	selector := labels.NewSelector().Add(*exists)
+	if minDepth > 0 {
+		req, err := labels.NewRequirement(label, selection.GreaterThan, []string{strconv.Itoa(minDepth - 1)})
+		if err != nil {
+			return nil, invalidRootError(parent, err)
+		}
+		selector = selector.Add(*req)
+	}
+	if maxDepth >= 0 {
+		req, err := labels.NewRequirement(label, selection.LessThan, []string{strconv.Itoa(maxDepth + 1)})
+		if err != nil {
+			return nil, invalidRootError(parent, err)
+		}
+		selector = selector.Add(*req)
+	}
+	return selector, nil
+}
+
+// invalidRootError is returned for a parent namespace that can't be part of a depth label.
+func invalidRootError(parent string, err error) error {
+	return apierrors.NewBadRequest(fmt.Sprintf("invalid parent namespace %q: %v", parent, err))
+}
+
+// namespaceSelector returns the selector in the namespaceSelector query parameter.
+func namespaceSelector(query url.Values) (labels.Selector, error) {
+	selector, err := labels.Parse(query.Get(namespaceSelectorParam))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid %s: %v", namespaceSelectorParam, err))
+	}
+	return selector, nil
+}
+
+func depthParam(query url.Values, param string, defaultValue int) (int, error) {
+	value := query.Get(param)
+	if value == "" {
+		return defaultValue, nil
+	}
+	depth, err := strconv.Atoi(value)
+	// the selector compares against depth+1, which must not overflow
+	if err != nil || depth < 0 || depth == math.MaxInt {
+		return 0, apierrors.NewBadRequest(fmt.Sprintf("%s must be a non-negative integer", param))
+	}
+	return depth, nil
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cmurphy/hns-list/pkg/consts"
+	"github.com/gorilla/mux"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestSubtreeSelector(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		query  url.Values
+		want   string
+	}{
+		{
+			name:   "whole subtree",
+			parent: "parent1",
+			want:   "parent1.tree.hnc.x-k8s.io/depth",
+		},
+		{
+			name:   "depth range",
+			parent: "parent1",
+			query:  url.Values{minDepthParam: {"1"}, maxDepthParam: {"2"}},
+			want:   "parent1.tree.hnc.x-k8s.io/depth,parent1.tree.hnc.x-k8s.io/depth>0,parent1.tree.hnc.x-k8s.io/depth<3",
+		},
+		{
+			name:   "children only",
+			parent: "parent1",
+			query:  url.Values{childrenOnlyParam: {"true"}},
+			want:   "parent1.tree.hnc.x-k8s.io/depth,parent1.tree.hnc.x-k8s.io/depth>0,parent1.tree.hnc.x-k8s.io/depth<2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selector, err := subtreeSelector(test.parent, test.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := selector.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubtreeSelectorInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		query  url.Values
+	}{
+		{
+			name:   "invalid parent",
+			parent: "not/a namespace",
+		},
+		{
+			name:   "parent too long",
+			parent: strings.Repeat("a", 300),
+		},
+		{
+			name:   "negative depth",
+			parent: "parent1",
+			query:  url.Values{minDepthParam: {"-1"}},
+		},
+		{
+			name:   "depth not a number",
+			parent: "parent1",
+			query:  url.Values{maxDepthParam: {"deep"}},
+		},
+		{
+			name:   "largest depth",
+			parent: "parent1",
+			query:  url.Values{maxDepthParam: {strconv.Itoa(math.MaxInt)}},
+		},
+		{
+			name:   "max depth below min depth",
+			parent: "parent1",
+			query:  url.Values{minDepthParam: {"2"}, maxDepthParam: {"1"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := subtreeSelector(test.parent, test.query)
+			if !apierrors.IsBadRequest(err) {
+				t.Errorf("expected a bad request error, got %v", err)
+			}
+		})
+	}
+}
+
+// labeledNamespaces returns namespaces under the roots a and x, labeled with an environment.
+func labeledNamespaces() []*corev1.Namespace {
+	namespaces := []*corev1.Namespace{
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+		hncNamespace("c", map[string]string{"c": "0", "a": "1"}),
+		hncNamespace("x", map[string]string{"x": "0"}),
+	}
+	for i, env := range []string{"prod", "dev", "prod", "prod"} {
+		namespaces[i].Labels["env"] = env
+	}
+	return namespaces
+}
+
+func TestNamespaceSelector(t *testing.T) {
+	namespaces := testNamespaceCache(labeledNamespaces()...)
+	tests := []struct {
+		name    string
+		handler func(clientGetter) http.HandlerFunc
+		path    string
+		vars    map[string]string
+		want    []string
+	}{
+		{
+			name: "subtree",
+			handler: func(clients clientGetter) http.HandlerFunc {
+				return NamespaceHandler(clients, fakeAPIs{}, namespaces, nil, nil)
+			},
+			path: "/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets",
+			vars: map[string]string{"namespace": "a", "resource": "secrets"},
+			want: []string{"a", "c"},
+		},
+		{
+			name: "cluster-wide",
+			handler: func(clients clientGetter) http.HandlerFunc {
+				return Forwarder(clients, fakeAPIs{}, namespaces, nil, nil)
+			},
+			path: "/apis/resources.hns.demo/v1alpha1/secrets",
+			vars: map[string]string{"resource": "secrets"},
+			want: []string{"a", "c", "x"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s1"}, "c": {"s1"}, "x": {"s1"}}}
+			handler := test.handler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}))
+
+			w := httptest.NewRecorder()
+			handler(w, testRequest(test.path+"?namespaceSelector=env%3Dprod", test.vars))
+			if w.Code != http.StatusOK {
+				t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+			}
+			page := testPage{}
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+			}
+			want := make([]string, 0, len(test.want))
+			for _, ns := range test.want {
+				want = append(want, ns+"/s1")
+			}
+			if !reflect.DeepEqual(page.names(), want) {
+				t.Errorf("got %v, want %v", page.names(), want)
+			}
+			// only the selected namespaces are listed, never the whole cluster
+			queried := make([]string, 0, len(client.calls))
+			for _, call := range client.calls {
+				queried = append(queried, call.namespace)
+			}
+			sort.Strings(queried)
+			if !reflect.DeepEqual(queried, test.want) {
+				t.Errorf("got lists in %v, want %v", queried, test.want)
+			}
+
+			client.calls = nil
+			w = httptest.NewRecorder()
+			handler(w, testRequest(test.path+"?namespaceSelector=env+in+prod", test.vars))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("got status %d for an invalid selector, want %d", w.Code, http.StatusBadRequest)
+			}
+			if len(client.calls) != 0 {
+				t.Errorf("expected no lists, got %+v", client.calls)
+			}
+		})
+	}
+}
+
+// A namespace under several of the requested roots is listed once, and each root is authorized once however often
+// it is requested.
+func TestOverlappingRoots(t *testing.T) {
+	namespaces := testNamespaceCache(
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+		hncNamespace("c", map[string]string{"c": "0", "b": "1", "a": "2"}),
+		hncNamespace("x", map[string]string{"x": "0"}),
+	)
+	client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s1"}, "c": {"s1"}, "x": {"s1"}}}
+	group := "/" + consts.Group + "/secrets/list"
+	authorizer := &fakeAuthorizer{allowed: map[string]bool{"a" + group: true, "b" + group: true}}
+	router := mux.NewRouter()
+	router.HandleFunc("/apis/resources.hns.demo/v1alpha1/namespaces/{namespace}/{resource}", NamespaceHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, namespaces, nil, nil))
+	router.Use(AuthorizeMiddleware(authorizer, fakeAPIs{}))
+
+	r := httptest.NewRequest(http.MethodGet, "/apis/resources.hns.demo/v1alpha1/namespaces/a,b,a/secrets?root=b", nil)
+	r = r.WithContext(request.WithUser(r.Context(), &user.DefaultInfo{Name: "alice"}))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	if want := []string{"a" + group, "b" + group}; !reflect.DeepEqual(authorizer.calls, want) {
+		t.Errorf("got access reviews %v, want %v", authorizer.calls, want)
+	}
+	page := testPage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	if want := []string{"a/s1", "b/s1", "c/s1"}; !reflect.DeepEqual(page.names(), want) {
+		t.Errorf("got %v, want %v", page.names(), want)
+	}
+	queried := make([]string, 0, len(client.calls))
+	for _, call := range client.calls {
+		queried = append(queried, call.namespace)
+	}
+	sort.Strings(queried)
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(queried, want) {
+		t.Errorf("got lists in %v, want %v", queried, want)
+	}
+}
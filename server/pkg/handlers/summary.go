@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/cmurphy/hns-list/pkg/audit"
+	"github.com/cmurphy/hns-list/pkg/consts"
+	"github.com/cmurphy/hns-list/pkg/ratelimit"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	summaryParam  = "summary"
+	summaryCounts = "counts"
+	// countPageSize is the page size for counting objects when there is no remaining item count.
+	countPageSize = int64(500)
+)
+
+// namespaceCount is the number of objects in a namespace and in its subtree.
+type namespaceCount struct {
+	Namespace    string `json:"namespace"`
+	Count        int64  `json:"count"`
+	SubtreeCount int64  `json:"subtreeCount"`
+}
+
+// summaryHandler returns the number of objects in each of the namespaces and their subtrees.
+func summaryHandler(w http.ResponseWriter, r *http.Request, resource schema.GroupVersionResource, client dynamic.NamespaceableResourceInterface, namespaces []*corev1.Namespace, opts metav1.ListOptions) {
+	if summary := r.URL.Query().Get(summaryParam); summary != summaryCounts {
+		isErrorAndHandleError(w, apierrors.NewBadRequest(fmt.Sprintf("unsupported summary %q, only %q is supported", summary, summaryCounts)))
+		return
+	}
+	audit.SetNamespacesQueried(r.Context(), len(namespaces))
+	if isErrorAndHandleError(w, ratelimit.ReserveNamespaces(r.Context(), len(namespaces))) {
+		return
+	}
+
+	counts := make(map[string]int64, len(namespaces))
+	errs := newNamespaceErrors(partialResults(r))
+	var lock sync.Mutex
+	eg, ctx := errgroup.WithContext(withMetadataOnly(r.Context()))
+	sem := semaphore.NewWeighted(ratelimit.NamespaceWorkers(r.Context()))
+	for _, ns := range namespaces {
+		ns := ns.Name
+		if err := sem.Acquire(ctx, 1); err != nil {
+			// the context is only done if a count failed or the client went away, which Wait reports below
+			eg.Go(func() error { return err })
+			break
+		}
+		eg.Go(func() error {
+			defer sem.Release(1)
+			count, err := countObjects(ctx, client.Namespace(ns), opts)
+			if err != nil {
+				return errs.add(ns, err)
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			counts[ns] = count
+			return nil
+		})
+	}
+	err := eg.Wait()
+	if err == nil {
+		err = errs.err(len(namespaces))
+	}
+	if isErrorAndHandleError(w, err) {
+		return
+	}
+	errs.addWarnings(w)
+
+	paths := namespaceTreePaths(namespaces)
+	summaries := make([]namespaceCount, 0, len(counts))
+	subtreeCounts := make(map[string]int64, len(counts))
+	total := int64(0)
+	for ns, count := range counts {
+		total += count
+		for _, ancestor := range paths(ns) {
+			subtreeCounts[ancestor] += count
+		}
+	}
+	for ns, count := range counts {
+		summaries = append(summaries, namespaceCount{Namespace: ns, Count: count, SubtreeCount: subtreeCounts[ns]})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Namespace < summaries[j].Namespace
+	})
+
+	meta := map[string]interface{}{}
+	errs.addMeta(meta)
+	audit.AddItemsReturned(r.Context(), len(summaries))
+	w.Header().Set("Content-Type", "application/json")
+	returnResp(w, map[string]interface{}{
+		"apiVersion": consts.GroupVersion,
+		"kind":       "NamespaceCountSummary",
+		"metadata":   meta,
+		"resource":   resource.GroupResource().String(),
+		"total":      total,
+		"namespaces": summaries,
+	})
+}
+
+// countObjects counts the objects in a namespace, page by page if there is no remaining item count.
+func countObjects(ctx context.Context, client dynamic.ResourceInterface, opts metav1.ListOptions) (int64, error) {
+	opts.Limit = 1
+	opts.Continue = ""
+	count := int64(0)
+	for {
+		list, err := client.List(ctx, opts)
+		if err != nil {
+			return 0, err
+		}
+		count += int64(len(list.Items))
+		if remaining := list.GetRemainingItemCount(); remaining != nil {
+			return count + *remaining, nil
+		}
+		if list.GetContinue() == "" {
+			return count, nil
+		}
+		// the rest of the list is at the resource version of the first page
+		opts.Continue = list.GetContinue()
+		opts.ResourceVersion = ""
+		opts.ResourceVersionMatch = ""
+		opts.Limit = countPageSize
+	}
+}
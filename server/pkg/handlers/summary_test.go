@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func summaryRequest(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	namespaces := testNamespaceCache(
+		hncNamespace("a", map[string]string{"a": "0"}),
+		hncNamespace("b", map[string]string{"b": "0", "a": "1"}),
+		hncNamespace("c", map[string]string{"c": "0", "b": "1", "a": "2"}),
+	)
+	client := &fakeClient{objects: map[string][]string{"a": {"s1"}, "b": {"s1", "s2"}, "c": {"s1", "s2", "s3"}}}
+	handler := NamespaceHandler(testClientGetter(map[schema.GroupVersionResource]*fakeClient{secretsResource: client}), fakeAPIs{}, namespaces, nil, nil)
+	w := httptest.NewRecorder()
+	handler(w, testRequest("/apis/resources.hns.demo/v1alpha1/namespaces/a/secrets?"+query, map[string]string{"namespace": "a", "resource": "secrets"}))
+	return w
+}
+
+// The fake client never reports the remaining item count, as for lists with a selector, so every namespace with more
+// than one object is counted page by page.
+func TestSummaryCounts(t *testing.T) {
+	for _, query := range []string{
+		"summary=counts",
+		"summary=counts&resourceVersion=100&labelSelector=app%3Dweb",
+		"summary=counts&resourceVersion=100&resourceVersionMatch=Exact",
+	} {
+		w := summaryRequest(t, query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d: %s", query, w.Code, w.Body.String())
+		}
+		summary := struct {
+			Total      int64            `json:"total"`
+			Namespaces []namespaceCount `json:"namespaces"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &summary); err != nil {
+			t.Fatalf("%s: invalid response %s: %v", query, w.Body.String(), err)
+		}
+		want := []namespaceCount{
+			{Namespace: "a", Count: 1, SubtreeCount: 6},
+			{Namespace: "b", Count: 2, SubtreeCount: 5},
+			{Namespace: "c", Count: 3, SubtreeCount: 3},
+		}
+		if summary.Total != 6 || !reflect.DeepEqual(summary.Namespaces, want) {
+			t.Errorf("%s: got total %d and %+v, want total 6 and %+v", query, summary.Total, summary.Namespaces, want)
+		}
+	}
+}
+
+func TestSummaryInvalid(t *testing.T) {
+	for _, query := range []string{"summary=sizes", "summary=counts&watch=true"} {
+		if w := summaryRequest(t, query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const includeObjectParam = "includeObject"
+
+// namespaceList is the list returned by a single namespace.
+type namespaceList struct {
+	namespace string
+	list      *unstructured.UnstructuredList
+}
+
+// upstreamIncludeObject returns the includeObject to request, which is at least Metadata.
+func upstreamIncludeObject(r *http.Request) string {
+	includeObject := r.URL.Query().Get(includeObjectParam)
+	if includeObject == string(metav1.IncludeNone) {
+		return string(metav1.IncludeMetadata)
+	}
+	return includeObject
+}
+
+// stripRowObjects removes the objects from Table rows if the client asked for includeObject=None.
+func stripRowObjects(r *http.Request, rows []interface{}) {
+	if r.URL.Query().Get(includeObjectParam) != string(metav1.IncludeNone) {
+		return
+	}
+	for _, row := range rows {
+		if rowMap, ok := row.(map[string]interface{}); ok {
+			delete(rowMap, "object")
+		}
+	}
+}
+
+// stripEventRowObjects removes the row objects of a Table event for includeObject=None.
+func stripEventRowObjects(r *http.Request, event watch.Event) {
+	obj, ok := event.Object.(*unstructured.Unstructured)
+	if !ok || obj.GetKind() != "Table" {
+		return
+	}
+	rows, _ := obj.Object["rows"].([]interface{})
+	stripRowObjects(r, rows)
+}
+
+// mergeLists merges the lists of each namespace in namespace order, with the union of any Table columns.
+func mergeLists(results []namespaceList) ([]interface{}, []unstructured.Unstructured, []interface{}) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].namespace < results[j].namespace
+	})
+	var columns []interface{}
+	columnIndex := make(map[string]int)
+	items := make([]unstructured.Unstructured, 0)
+	rows := make([]interface{}, 0)
+	for _, result := range results {
+		nsColumns, ok := result.list.Object["columnDefinitions"].([]interface{})
+		if !ok {
+			items = append(items, result.list.Items...)
+			continue
+		}
+		if columns == nil {
+			columns = make([]interface{}, 0, len(nsColumns))
+		}
+		for _, column := range nsColumns {
+			name := columnName(column)
+			if _, ok := columnIndex[name]; !ok {
+				columnIndex[name] = len(columns)
+				columns = append(columns, column)
+			}
+		}
+		nsRows, _ := result.list.Object["rows"].([]interface{})
+		rows = append(rows, nsRows...)
+	}
+	// rows from namespaces with fewer or differently ordered columns are rearranged to the merged order
+	for _, result := range results {
+		nsColumns, ok := result.list.Object["columnDefinitions"].([]interface{})
+		if !ok || sameColumns(nsColumns, columns) {
+			continue
+		}
+		nsRows, _ := result.list.Object["rows"].([]interface{})
+		rearrangeCells(nsRows, nsColumns, columnIndex, len(columns))
+	}
+	return columns, items, rows
+}
+
+// rearrangeCells moves the cells of each row to the position of their column in the index.
+func rearrangeCells(rows []interface{}, columns []interface{}, columnIndex map[string]int, width int) {
+	for _, row := range rows {
+		rowMap, ok := row.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		cells, _ := rowMap["cells"].([]interface{})
+		rearranged := make([]interface{}, width)
+		for i, column := range columns {
+			if j, ok := columnIndex[columnName(column)]; ok && i < len(cells) {
+				rearranged[j] = cells[i]
+			}
+		}
+		rowMap["cells"] = rearranged
+	}
+}
+
+func columnName(column interface{}) string {
+	columnMap, _ := column.(map[string]interface{})
+	name, _ := columnMap["name"].(string)
+	return name
+}
+
+func sameColumns(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if columnName(a[i]) != columnName(b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func namespaceTable(namespace string, columns []string, names ...string) namespaceList {
+	list := &unstructured.UnstructuredList{}
+	for _, name := range names {
+		list.Items = append(list.Items, *namespacedObject(namespace, name))
+	}
+	return namespaceList{namespace: namespace, list: fakeTable(list, columns)}
+}
+
+func namespaceObjects(namespace string, names ...string) namespaceList {
+	list := &unstructured.UnstructuredList{}
+	for _, name := range names {
+		list.Items = append(list.Items, *namespacedObject(namespace, name))
+	}
+	return namespaceList{namespace: namespace, list: list}
+}
+
+func columnNames(columns []interface{}) []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, columnName(column))
+	}
+	return names
+}
+
+func rowCells(rows []interface{}) [][]interface{} {
+	cells := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		rowMap, _ := row.(map[string]interface{})
+		rowCells, _ := rowMap["cells"].([]interface{})
+		cells = append(cells, rowCells)
+	}
+	return cells
+}
+
+func TestMergeListsColumns(t *testing.T) {
+	tests := []struct {
+		name        string
+		results     []namespaceList
+		wantColumns []string
+		wantCells   [][]interface{}
+	}{
+		{
+			name: "same columns",
+			results: []namespaceList{
+				namespaceTable("b", []string{"Name", "Age"}, "s1"),
+				namespaceTable("a", []string{"Name", "Age"}, "s1"),
+			},
+			wantColumns: []string{"Name", "Age"},
+			wantCells: [][]interface{}{
+				{"Name", "Age"},
+				{"Name", "Age"},
+			},
+		},
+		{
+			name: "extra column",
+			results: []namespaceList{
+				namespaceTable("b", []string{"Name", "Type", "Age"}, "s1"),
+				namespaceTable("a", []string{"Name", "Age"}, "s1", "s2"),
+			},
+			wantColumns: []string{"Name", "Age", "Type"},
+			wantCells: [][]interface{}{
+				{"Name", "Age", nil},
+				{"Name", "Age", nil},
+				{"Name", "Age", "Type"},
+			},
+		},
+		{
+			name: "different order",
+			results: []namespaceList{
+				namespaceTable("a", []string{"Name", "Age"}, "s1"),
+				namespaceTable("b", []string{"Age", "Name"}, "s1"),
+			},
+			wantColumns: []string{"Name", "Age"},
+			wantCells: [][]interface{}{
+				{"Name", "Age"},
+				{"Name", "Age"},
+			},
+		},
+		{
+			name: "disjoint columns",
+			results: []namespaceList{
+				namespaceTable("a", []string{"Name", "Ready"}, "s1"),
+				namespaceTable("b", []string{"Name", "Status"}, "s1"),
+				namespaceTable("c", []string{"Age"}, "s1"),
+			},
+			wantColumns: []string{"Name", "Ready", "Status", "Age"},
+			wantCells: [][]interface{}{
+				{"Name", "Ready", nil, nil},
+				{"Name", nil, "Status", nil},
+				{nil, nil, nil, "Age"},
+			},
+		},
+		{
+			name: "empty namespace with other columns",
+			results: []namespaceList{
+				namespaceTable("a", []string{"Name", "Extra"}),
+				namespaceTable("b", []string{"Name"}, "s1"),
+			},
+			wantColumns: []string{"Name", "Extra"},
+			wantCells: [][]interface{}{
+				{"Name", nil},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			columns, items, rows := mergeLists(test.results)
+			if len(items) != 0 {
+				t.Errorf("expected no items, got %d", len(items))
+			}
+			if got := columnNames(columns); !reflect.DeepEqual(got, test.wantColumns) {
+				t.Errorf("got columns %v, want %v", got, test.wantColumns)
+			}
+			if got := rowCells(rows); !reflect.DeepEqual(got, test.wantCells) {
+				t.Errorf("got cells %v, want %v", got, test.wantCells)
+			}
+		})
+	}
+}
+
+func TestMergeListsObjects(t *testing.T) {
+	columns, items, rows := mergeLists([]namespaceList{
+		namespaceObjects("b", "s1"),
+		namespaceObjects("a", "s2", "s1"),
+	})
+	if columns != nil {
+		t.Errorf("expected no columns, got %v", columns)
+	}
+	if len(rows) != 0 {
+		t.Errorf("expected no rows, got %d", len(rows))
+	}
+	got := make([]string, 0, len(items))
+	for _, item := range items {
+		got = append(got, item.GetNamespace()+"/"+item.GetName())
+	}
+	// namespaces are merged in name order, and each namespace keeps its own order
+	if want := []string{"a/s2", "a/s1", "b/s1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRearrangeCells(t *testing.T) {
+	columns := []interface{}{
+		map[string]interface{}{"name": "Age"},
+		map[string]interface{}{"name": "Unknown"},
+		map[string]interface{}{"name": "Name"},
+	}
+	columnIndex := map[string]int{"Name": 0, "Age": 1, "Type": 2}
+	rows := []interface{}{
+		map[string]interface{}{"cells": []interface{}{"1d", "x", "s1"}},
+		// a row with fewer cells than columns
+		map[string]interface{}{"cells": []interface{}{"2d"}},
+		"not a row",
+	}
+	rearrangeCells(rows, columns, columnIndex, 3)
+	want := [][]interface{}{
+		{"s1", "1d", nil},
+		{nil, "2d", nil},
+		nil,
+	}
+	if got := rowCells(rows); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
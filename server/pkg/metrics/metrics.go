@@ -0,0 +1,31 @@
+// Package metrics defines the Prometheus metrics exported by the extension server.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "hns_list"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	// ServingCertRotations counts how many times the serving certificate was reloaded from disk.
+	ServingCertRotations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "serving_cert_rotations_total",
+		Help:      "Number of times the serving certificate was reloaded from disk.",
+	})
+)
+
+func init() {
+	registry.MustRegister(ServingCertRotations)
+}
+
+// Handler returns an HTTP handler that serves the registered metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,78 @@
+// Package policy provides server-side policies applied to hierarchical requests regardless of the user.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// NamespaceExclusions describes namespaces that must never be queried or appear in hierarchical results.
+type NamespaceExclusions struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+	selector labels.Selector
+}
+
+// NewNamespaceExclusions creates a NamespaceExclusions that excludes namespaces with any of the given names, whose
+// name fully matches any of the given regular expressions, or whose labels match the given label selector.
+func NewNamespaceExclusions(names, patterns []string, selector string) (*NamespaceExclusions, error) {
+	e := &NamespaceExclusions{
+		names: make(map[string]bool, len(names)),
+	}
+	for _, name := range names {
+		e.names[name] = true
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace exclusion pattern %q: %w", pattern, err)
+		}
+		e.patterns = append(e.patterns, re)
+	}
+	if selector != "" {
+		parsed, err := labels.Parse(selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid namespace exclusion selector %q: %w", selector, err)
+		}
+		e.selector = parsed
+	}
+	return e, nil
+}
+
+// Empty returns true if no namespaces are excluded.
+func (e *NamespaceExclusions) Empty() bool {
+	return e == nil || (len(e.names) == 0 && len(e.patterns) == 0 && e.selector == nil)
+}
+
+// Excluded returns true if the namespace must be left out of hierarchical results.
+func (e *NamespaceExclusions) Excluded(namespace *corev1.Namespace) bool {
+	if e.Empty() {
+		return false
+	}
+	if e.names[namespace.Name] {
+		return true
+	}
+	for _, re := range e.patterns {
+		if re.MatchString(namespace.Name) {
+			return true
+		}
+	}
+	return e.selector != nil && e.selector.Matches(labels.Set(namespace.Labels))
+}
+
+// Filter returns the namespaces that are not excluded.
+func (e *NamespaceExclusions) Filter(namespaces []*corev1.Namespace) []*corev1.Namespace {
+	if e.Empty() {
+		return namespaces
+	}
+	filtered := make([]*corev1.Namespace, 0, len(namespaces))
+	for _, ns := range namespaces {
+		if !e.Excluded(ns) {
+			filtered = append(filtered, ns)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		name      string
+		names     []string
+		patterns  []string
+		selector  string
+		namespace *corev1.Namespace
+		want      bool
+	}{
+		{
+			name:      "no exclusions",
+			namespace: namespace("kube-system", nil),
+		},
+		{
+			name:      "name",
+			names:     []string{"kube-system"},
+			namespace: namespace("kube-system", nil),
+			want:      true,
+		},
+		{
+			name:      "other name",
+			names:     []string{"kube-system"},
+			namespace: namespace("kube-public", nil),
+		},
+		{
+			name:      "pattern",
+			patterns:  []string{"kube-.*"},
+			namespace: namespace("kube-public", nil),
+			want:      true,
+		},
+		{
+			name:      "pattern must match the whole name",
+			patterns:  []string{"kube"},
+			namespace: namespace("kube-public", nil),
+		},
+		{
+			name:      "alternatives are anchored",
+			patterns:  []string{"kube|system"},
+			namespace: namespace("my-system", nil),
+		},
+		{
+			name:      "selector",
+			selector:  "hidden=true",
+			namespace: namespace("a", map[string]string{"hidden": "true"}),
+			want:      true,
+		},
+		{
+			name:      "selector does not match",
+			selector:  "hidden=true",
+			namespace: namespace("a", map[string]string{"hidden": "false"}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exclusions, err := NewNamespaceExclusions(test.names, test.patterns, test.selector)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := exclusions.Excluded(test.namespace); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewNamespaceExclusionsInvalid(t *testing.T) {
+	if _, err := NewNamespaceExclusions(nil, []string{"("}, ""); err == nil {
+		t.Errorf("expected an invalid pattern to be rejected")
+	}
+	if _, err := NewNamespaceExclusions(nil, nil, "a in ("); err == nil {
+		t.Errorf("expected an invalid selector to be rejected")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	namespaces := []*corev1.Namespace{
+		namespace("a", nil),
+		namespace("kube-system", nil),
+		namespace("b", map[string]string{"hidden": "true"}),
+		namespace("c", nil),
+	}
+	exclusions, err := NewNamespaceExclusions([]string{"c"}, []string{"kube-.*"}, "hidden")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	names := make([]string, 0)
+	for _, ns := range exclusions.Filter(namespaces) {
+		names = append(names, ns.Name)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+	var none *NamespaceExclusions
+	if !none.Empty() || len(none.Filter(namespaces)) != len(namespaces) {
+		t.Errorf("expected no exclusions to keep every namespace")
+	}
+}
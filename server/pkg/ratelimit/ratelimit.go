@@ -0,0 +1,167 @@
+// Package ratelimit limits how many hierarchical requests run at once and how many namespaces they query.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+const (
+	// retryAfterSeconds is the delay suggested to clients that are over an in-flight limit.
+	retryAfterSeconds = 1
+	userCacheSize     = 10000
+	userCacheTTL      = 10 * time.Minute
+	// defaultNamespaceWorkers is the number of namespaces a single request queries at once if it is not configured.
+	defaultNamespaceWorkers = 3
+)
+
+type contextKey struct{}
+
+// namespaceBudget is stored in the request context for use by ReserveNamespaces and NamespaceWorkers.
+type namespaceBudget struct {
+	// user and global are nil if their limit is disabled.
+	user    *rate.Limiter
+	global  *rate.Limiter
+	workers int
+}
+
+// Config holds the limits. A limit of zero disables it.
+type Config struct {
+	// MaxInflight is the number of hierarchical requests that may run at once across all users.
+	MaxInflight int
+	// MaxInflightPerUser is the number of hierarchical requests that may run at once for a single user.
+	MaxInflightPerUser int
+	// NamespaceQPSPerUser is the sustained rate at which a single user may query namespaces.
+	NamespaceQPSPerUser float64
+	// NamespaceBurstPerUser is the number of namespaces a single user may query at once.
+	NamespaceBurstPerUser int
+	// NamespaceQPS is the sustained rate at which all users together may query namespaces.
+	NamespaceQPS float64
+	// NamespaceBurst is the number of namespaces all users together may query at once.
+	NamespaceBurst int
+	// NamespaceWorkers is the number of namespaces a single request queries at the same time.
+	NamespaceWorkers int
+}
+
+// Limiter tracks in-flight requests and namespace queries per user and across all users.
+type Limiter struct {
+	config Config
+	// namespaceLimiter is the namespace budget shared by all users, nil if it is disabled.
+	namespaceLimiter *rate.Limiter
+
+	mu                sync.Mutex
+	inflight          int
+	inflightPerUser   map[string]int
+	namespaceLimiters *cache.LRUExpireCache
+}
+
+// NewLimiter creates a Limiter with the given limits.
+func NewLimiter(config Config) *Limiter {
+	l := &Limiter{
+		config:            config,
+		inflightPerUser:   make(map[string]int),
+		namespaceLimiters: cache.NewLRUExpireCache(userCacheSize),
+	}
+	if config.NamespaceQPS > 0 {
+		l.namespaceLimiter = rate.NewLimiter(rate.Limit(config.NamespaceQPS), config.NamespaceBurst)
+	}
+	return l
+}
+
+// Acquire reserves an in-flight slot for the user. The returned function must be called when the request is done.
+// An error with status 429 is returned if the user or the server is over its in-flight limit.
+func (l *Limiter) Acquire(user string) (func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config.MaxInflight > 0 && l.inflight >= l.config.MaxInflight {
+		return nil, apierrors.NewTooManyRequests("too many requests in flight, please try again later", retryAfterSeconds)
+	}
+	if l.config.MaxInflightPerUser > 0 && l.inflightPerUser[user] >= l.config.MaxInflightPerUser {
+		return nil, apierrors.NewTooManyRequests(fmt.Sprintf("too many requests in flight for user %s, please try again later", user), retryAfterSeconds)
+	}
+	l.inflight++
+	l.inflightPerUser[user]++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.inflight--
+		l.inflightPerUser[user]--
+		if l.inflightPerUser[user] == 0 {
+			delete(l.inflightPerUser, user)
+		}
+	}, nil
+}
+
+// WithUser returns a context that carries the user's and the global namespace rate limiters and the number of
+// namespace workers, for use by ReserveNamespaces and NamespaceWorkers.
+func (l *Limiter) WithUser(ctx context.Context, user string) context.Context {
+	budget := &namespaceBudget{global: l.namespaceLimiter, workers: l.config.NamespaceWorkers}
+	if l.config.NamespaceQPSPerUser > 0 {
+		l.mu.Lock()
+		limiter, ok := l.namespaceLimiters.Get(user)
+		if !ok {
+			limiter = rate.NewLimiter(rate.Limit(l.config.NamespaceQPSPerUser), l.config.NamespaceBurstPerUser)
+		}
+		l.namespaceLimiters.Add(user, limiter, userCacheTTL)
+		l.mu.Unlock()
+		budget.user = limiter.(*rate.Limiter)
+	}
+	return context.WithValue(ctx, contextKey{}, budget)
+}
+
+// ReserveNamespaces takes n namespace queries from both the user's and the global budget. A request for more
+// namespaces than a burst size uses up that whole burst. An error with status 429 is returned if either budget is not
+// available yet, in which case neither is charged.
+func ReserveNamespaces(ctx context.Context, n int) error {
+	budget, ok := ctx.Value(contextKey{}).(*namespaceBudget)
+	if !ok || n == 0 {
+		return nil
+	}
+	now := time.Now()
+	reservations := make([]*rate.Reservation, 0, 2)
+	cancel := func() {
+		for _, reservation := range reservations {
+			reservation.CancelAt(now)
+		}
+	}
+	delay := time.Duration(0)
+	for _, limiter := range []*rate.Limiter{budget.user, budget.global} {
+		if limiter == nil {
+			continue
+		}
+		tokens := n
+		if burst := limiter.Burst(); tokens > burst {
+			tokens = burst
+		}
+		reservation := limiter.ReserveN(now, tokens)
+		if !reservation.OK() {
+			cancel()
+			return apierrors.NewTooManyRequests("namespace query limit exceeded, please try again later", retryAfterSeconds)
+		}
+		reservations = append(reservations, reservation)
+		if d := reservation.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		cancel()
+		retryAfter := int(math.Ceil(delay.Seconds()))
+		return apierrors.NewTooManyRequests(fmt.Sprintf("namespace query limit exceeded, please try again in %d seconds", retryAfter), retryAfter)
+	}
+	return nil
+}
+
+// NamespaceWorkers returns how many namespaces a request may query at the same time.
+func NamespaceWorkers(ctx context.Context) int64 {
+	if budget, ok := ctx.Value(contextKey{}).(*namespaceBudget); ok && budget.workers > 0 {
+		return int64(budget.workers)
+	}
+	return defaultNamespaceWorkers
+}
@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestReserveNamespacesGlobal(t *testing.T) {
+	limiter := NewLimiter(Config{
+		NamespaceQPSPerUser:   1,
+		NamespaceBurstPerUser: 10,
+		NamespaceQPS:          1,
+		NamespaceBurst:        15,
+	})
+	alice := limiter.WithUser(context.Background(), "alice")
+	bob := limiter.WithUser(context.Background(), "bob")
+
+	if err := ReserveNamespaces(alice, 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the per-user budget of bob is untouched, but only 5 namespaces are left in the global budget
+	err := ReserveNamespaces(bob, 10)
+	if !apierrors.IsTooManyRequests(err) {
+		t.Fatalf("expected a too many requests error, got %v", err)
+	}
+	if seconds, ok := apierrors.SuggestsClientDelay(err); !ok || seconds < 1 {
+		t.Errorf("expected a retry delay, got %d", seconds)
+	}
+	// the failed reservation took nothing from either budget
+	if err := ReserveNamespaces(bob, 5); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNamespaceWorkers(t *testing.T) {
+	if got := NamespaceWorkers(context.Background()); got != defaultNamespaceWorkers {
+		t.Errorf("got %d workers without a limiter, want %d", got, defaultNamespaceWorkers)
+	}
+	ctx := NewLimiter(Config{NamespaceWorkers: 8}).WithUser(context.Background(), "alice")
+	if got := NamespaceWorkers(ctx); got != 8 {
+		t.Errorf("got %d workers, want 8", got)
+	}
+}
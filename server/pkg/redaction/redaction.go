@@ -0,0 +1,259 @@
+// Package redaction removes or masks sensitive fields from objects before they are returned to the client.
+package redaction
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// Mask is the value that replaces masked fields.
+const Mask = "REDACTED"
+
+// lastAppliedAnnotation is set by kubectl apply to a copy of the applied object, which would otherwise still
+// contain every redacted field.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Action is what to do with a matched field.
+type Action string
+
+const (
+	// ActionMask replaces the value with Mask. Maps and lists keep their keys and length, with every value masked.
+	ActionMask Action = "mask"
+	// ActionRemove removes the field from the object.
+	ActionRemove Action = "remove"
+)
+
+// Config is the redaction configuration file.
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule redacts fields from objects of a resource.
+type Rule struct {
+	// Group is the API group of the resource, empty for the core group.
+	Group string `json:"group"`
+	// Version is the API version of the resource. The rule applies to all versions if empty.
+	Version string `json:"version,omitempty"`
+	// Resource is the plural resource name, for example secrets.
+	Resource string `json:"resource"`
+	// Paths are the fields to redact as dot-separated field names, where name[*] matches every element of a list,
+	// for example spec.containers[*].env[*].value.
+	Paths []string `json:"paths"`
+	// KeyPattern is a regular expression. If set, each path must point to a map, and only the keys of the map that
+	// fully match the expression are redacted.
+	KeyPattern string `json:"keyPattern,omitempty"`
+	// Action is mask or remove. The default is mask.
+	Action Action `json:"action,omitempty"`
+}
+
+type contextKey struct{}
+
+type rule struct {
+	gvr        schema.GroupVersionResource
+	paths      [][]segment
+	keyPattern *regexp.Regexp
+	action     Action
+}
+
+type segment struct {
+	field string
+	all   bool
+}
+
+// Redactor applies the redaction rules to objects.
+type Redactor struct {
+	rules []rule
+}
+
+// Load reads the redaction configuration from the file at path. An empty path gives a Redactor with no rules.
+func Load(path string) (*Redactor, error) {
+	if path == "" {
+		return &Redactor{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := Config{}
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid redaction config: %w", err)
+	}
+	return New(config)
+}
+
+// New creates a Redactor from the configuration.
+func New(config Config) (*Redactor, error) {
+	r := &Redactor{}
+	for _, configRule := range config.Rules {
+		compiled := rule{
+			gvr:    schema.GroupVersionResource{Group: configRule.Group, Version: configRule.Version, Resource: configRule.Resource},
+			action: configRule.Action,
+		}
+		switch compiled.action {
+		case "":
+			compiled.action = ActionMask
+		case ActionMask, ActionRemove:
+		default:
+			return nil, fmt.Errorf("invalid redaction action %q for %s", configRule.Action, compiled.gvr.GroupResource())
+		}
+		if configRule.KeyPattern != "" {
+			re, err := regexp.Compile("^(?:" + configRule.KeyPattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid redaction key pattern %q: %w", configRule.KeyPattern, err)
+			}
+			compiled.keyPattern = re
+		}
+		for _, path := range configRule.Paths {
+			segments, err := parsePath(path)
+			if err != nil {
+				return nil, err
+			}
+			compiled.paths = append(compiled.paths, segments)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// WithoutRedaction returns a context for a request whose user is allowed to see unredacted objects and asked to.
+func WithoutRedaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, true)
+}
+
+// Redact redacts the fields of a single object of the given resource in place. If any rule applies to the
+// resource, the last applied configuration annotation is removed as well.
+func (r *Redactor) Redact(ctx context.Context, gvr schema.GroupVersionResource, obj map[string]interface{}) {
+	if r == nil || len(r.rules) == 0 || obj == nil {
+		return
+	}
+	if disabled, _ := ctx.Value(contextKey{}).(bool); disabled {
+		return
+	}
+	matched := false
+	for _, rule := range r.rules {
+		if !rule.matches(gvr) {
+			continue
+		}
+		matched = true
+		for _, path := range rule.paths {
+			rule.apply(obj, path)
+		}
+	}
+	if matched {
+		removeLastApplied(obj)
+	}
+}
+
+func removeLastApplied(obj map[string]interface{}) {
+	metadata, _ := obj["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	delete(annotations, lastAppliedAnnotation)
+}
+
+// RedactRows redacts the objects embedded in Table rows in place.
+func (r *Redactor) RedactRows(ctx context.Context, gvr schema.GroupVersionResource, rows []interface{}) {
+	for _, row := range rows {
+		rowMap, _ := row.(map[string]interface{})
+		obj, _ := rowMap["object"].(map[string]interface{})
+		r.Redact(ctx, gvr, obj)
+	}
+}
+
+func (r rule) matches(gvr schema.GroupVersionResource) bool {
+	if r.gvr.Group != gvr.Group || r.gvr.Resource != gvr.Resource {
+		return false
+	}
+	return r.gvr.Version == "" || r.gvr.Version == gvr.Version
+}
+
+func (r rule) apply(obj map[string]interface{}, path []segment) {
+	seg := path[0]
+	value, ok := obj[seg.field]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		r.redactField(obj, seg)
+		return
+	}
+	if !seg.all {
+		if child, ok := value.(map[string]interface{}); ok {
+			r.apply(child, path[1:])
+		}
+		return
+	}
+	list, _ := value.([]interface{})
+	for _, elem := range list {
+		if child, ok := elem.(map[string]interface{}); ok {
+			r.apply(child, path[1:])
+		}
+	}
+}
+
+func (r rule) redactField(obj map[string]interface{}, seg segment) {
+	if r.keyPattern != nil {
+		m, ok := obj[seg.field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		for key := range m {
+			if !r.keyPattern.MatchString(key) {
+				continue
+			}
+			if r.action == ActionRemove {
+				delete(m, key)
+				continue
+			}
+			m[key] = mask(m[key])
+		}
+		return
+	}
+	if r.action == ActionRemove {
+		delete(obj, seg.field)
+		return
+	}
+	obj[seg.field] = mask(obj[seg.field])
+}
+
+// mask replaces a value with Mask, keeping the keys of maps and the length of lists.
+func mask(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = Mask
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = Mask
+		}
+		return v
+	}
+	return Mask
+}
+
+func parsePath(path string) ([]segment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("invalid redaction path: path is empty")
+	}
+	parts := strings.Split(path, ".")
+	segments := make([]segment, 0, len(parts))
+	for _, part := range parts {
+		seg := segment{field: part}
+		if strings.HasSuffix(part, "[*]") {
+			seg.field = strings.TrimSuffix(part, "[*]")
+			seg.all = true
+		}
+		if seg.field == "" || strings.ContainsAny(seg.field, "[]") {
+			return nil, fmt.Errorf("invalid redaction path %q", path)
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
@@ -0,0 +1,253 @@
+package redaction
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	secrets = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	pods    = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    []segment
+		wantErr bool
+	}{
+		{
+			name: "single field",
+			path: "data",
+			want: []segment{{field: "data"}},
+		},
+		{
+			name: "nested fields",
+			path: "spec.template.spec",
+			want: []segment{{field: "spec"}, {field: "template"}, {field: "spec"}},
+		},
+		{
+			name: "wildcard list indexes",
+			path: "spec.containers[*].env[*].value",
+			want: []segment{{field: "spec"}, {field: "containers", all: true}, {field: "env", all: true}, {field: "value"}},
+		},
+		{
+			name:    "empty path",
+			path:    "",
+			wantErr: true,
+		},
+		{
+			name:    "empty segment",
+			path:    "spec..value",
+			wantErr: true,
+		},
+		{
+			name:    "wildcard without field",
+			path:    "spec.[*]",
+			wantErr: true,
+		},
+		{
+			name:    "numeric index",
+			path:    "spec.containers[0].image",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parsePath(test.path)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  []Rule
+		gvr    schema.GroupVersionResource
+		object string
+		want   string
+	}{
+		{
+			name:   "mask map values",
+			rules:  []Rule{{Resource: "secrets", Paths: []string{"data"}}},
+			gvr:    secrets,
+			object: `{"data":{"user":"YWRtaW4=","password":"c2VjcmV0"}}`,
+			want:   `{"data":{"user":"REDACTED","password":"REDACTED"}}`,
+		},
+		{
+			name:   "remove field",
+			rules:  []Rule{{Resource: "secrets", Paths: []string{"data"}, Action: ActionRemove}},
+			gvr:    secrets,
+			object: `{"data":{"user":"YWRtaW4="},"type":"Opaque"}`,
+			want:   `{"type":"Opaque"}`,
+		},
+		{
+			name:   "key pattern",
+			rules:  []Rule{{Resource: "secrets", Paths: []string{"data"}, KeyPattern: "pass.*"}},
+			gvr:    secrets,
+			object: `{"data":{"user":"YWRtaW4=","password":"c2VjcmV0"}}`,
+			want:   `{"data":{"user":"YWRtaW4=","password":"REDACTED"}}`,
+		},
+		{
+			name:   "wildcard list indexes",
+			rules:  []Rule{{Resource: "pods", Paths: []string{"spec.containers[*].env[*].value"}}},
+			gvr:    pods,
+			object: `{"spec":{"containers":[{"env":[{"name":"A","value":"1"},{"name":"B"}]},{"env":[{"name":"C","value":"3"}]},{"name":"no-env"}]}}`,
+			want:   `{"spec":{"containers":[{"env":[{"name":"A","value":"REDACTED"},{"name":"B"}]},{"env":[{"name":"C","value":"REDACTED"}]},{"name":"no-env"}]}}`,
+		},
+		{
+			name:   "missing path",
+			rules:  []Rule{{Resource: "pods", Paths: []string{"spec.initContainers[*].env[*].value", "status.secret"}}},
+			gvr:    pods,
+			object: `{"spec":{"containers":[]}}`,
+			want:   `{"spec":{"containers":[]}}`,
+		},
+		{
+			name:   "path through a non-map",
+			rules:  []Rule{{Resource: "pods", Paths: []string{"spec.containers.env", "spec.volumes[*].name"}}},
+			gvr:    pods,
+			object: `{"spec":{"containers":"invalid","volumes":{"name":"v"}}}`,
+			want:   `{"spec":{"containers":"invalid","volumes":{"name":"v"}}}`,
+		},
+		{
+			name:   "non-string leaves",
+			rules:  []Rule{{Resource: "pods", Paths: []string{"spec.replicas", "spec.enabled", "spec.ports", "spec.labels"}}},
+			gvr:    pods,
+			object: `{"spec":{"replicas":3,"enabled":true,"ports":[80,443],"labels":{"a":{"b":"c"}}}}`,
+			want:   `{"spec":{"replicas":"REDACTED","enabled":"REDACTED","ports":["REDACTED","REDACTED"],"labels":{"a":"REDACTED"}}}`,
+		},
+		{
+			name:   "key pattern on a non-map",
+			rules:  []Rule{{Resource: "secrets", Paths: []string{"data"}, KeyPattern: ".*"}},
+			gvr:    secrets,
+			object: `{"data":"c2VjcmV0"}`,
+			want:   `{"data":"c2VjcmV0"}`,
+		},
+		{
+			name:   "other resource",
+			rules:  []Rule{{Resource: "secrets", Paths: []string{"data"}}},
+			gvr:    schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+			object: `{"metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}"}},"data":{"a":"b"}}`,
+			want:   `{"metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}"}},"data":{"a":"b"}}`,
+		},
+		{
+			name:   "other version",
+			rules:  []Rule{{Resource: "secrets", Version: "v2", Paths: []string{"data"}}},
+			gvr:    secrets,
+			object: `{"data":{"a":"b"}}`,
+			want:   `{"data":{"a":"b"}}`,
+		},
+		{
+			name:   "last applied configuration",
+			rules:  []Rule{{Resource: "secrets", Paths: []string{"data"}}},
+			gvr:    secrets,
+			object: `{"metadata":{"name":"s","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"a\":\"c2VjcmV0\"}}","other":"kept"}},"data":{"a":"c2VjcmV0"}}`,
+			want:   `{"metadata":{"name":"s","annotations":{"other":"kept"}},"data":{"a":"REDACTED"}}`,
+		},
+		{
+			name:   "last applied configuration in metadata only",
+			rules:  []Rule{{Resource: "secrets", Paths: []string{"data"}}},
+			gvr:    secrets,
+			object: `{"kind":"PartialObjectMetadata","metadata":{"name":"s","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}"}}}`,
+			want:   `{"kind":"PartialObjectMetadata","metadata":{"name":"s","annotations":{}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redactor, err := New(Config{Rules: test.rules})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			obj := decode(t, test.object)
+			redactor.Redact(context.Background(), test.gvr, obj)
+			if want := decode(t, test.want); !reflect.DeepEqual(obj, want) {
+				t.Errorf("got %v, want %v", obj, want)
+			}
+		})
+	}
+}
+
+func TestRedactWithoutRedaction(t *testing.T) {
+	redactor, err := New(Config{Rules: []Rule{{Resource: "secrets", Paths: []string{"data"}}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	object := `{"metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}"}},"data":{"a":"c2VjcmV0"}}`
+	obj := decode(t, object)
+	redactor.Redact(WithoutRedaction(context.Background()), secrets, obj)
+	if want := decode(t, object); !reflect.DeepEqual(obj, want) {
+		t.Errorf("got %v, want %v", obj, want)
+	}
+}
+
+func TestRedactRows(t *testing.T) {
+	redactor, err := New(Config{Rules: []Rule{{Resource: "secrets", Paths: []string{"data"}}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows := []interface{}{
+		decode(t, `{"cells":["s1"],"object":{"data":{"a":"c2VjcmV0"}}}`),
+		decode(t, `{"cells":["s2"]}`),
+	}
+	redactor.RedactRows(context.Background(), secrets, rows)
+	want := []interface{}{
+		decode(t, `{"cells":["s1"],"object":{"data":{"a":"REDACTED"}}}`),
+		decode(t, `{"cells":["s2"]}`),
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got %v, want %v", rows, want)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{
+			name: "action",
+			rule: Rule{Resource: "secrets", Paths: []string{"data"}, Action: "hide"},
+		},
+		{
+			name: "key pattern",
+			rule: Rule{Resource: "secrets", Paths: []string{"data"}, KeyPattern: "("},
+		},
+		{
+			name: "path",
+			rule: Rule{Resource: "secrets", Paths: []string{"data[0]"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := New(Config{Rules: []Rule{test.rule}}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	obj := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatalf("invalid test object %s: %v", data, err)
+	}
+	return obj
+}